@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ossf/package-feeds/pkg/backfill"
+)
+
+var (
+	errInvalidWindow      = errors.New("invalid backfill window")
+	errIncompleteBackfill = errors.New("feeds did not cover the requested window")
+)
+
+func runBackfill(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("PACKAGE_FEEDS_CONFIG_PATH"), "path to the feeds config file")
+	feedNames := flags.String("feeds", "", "comma separated feeds to backfill, defaults to all configured feeds")
+	sinceFlag := flags.String("since", "", "start of the window, as a RFC 3339 timestamp or a duration before now")
+	untilFlag := flags.String("until", "", "end of the window, as a RFC 3339 timestamp or a duration before now")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if *sinceFlag == "" {
+		return fmt.Errorf("%w: --since is required", errInvalidWindow)
+	}
+	since, err := parseTime(*sinceFlag, now)
+	if err != nil {
+		return err
+	}
+	until := now.UTC()
+	if *untilFlag != "" {
+		until, err = parseTime(*untilFlag, now)
+		if err != nil {
+			return err
+		}
+	}
+	if !since.Before(until) {
+		return fmt.Errorf("%w: --since %v is not before --until %v", errInvalidWindow, since, until)
+	}
+
+	appConfig, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	scheduledFeeds, err := selectFeeds(appConfig, *feedNames)
+	if err != nil {
+		return err
+	}
+	pub, err := appConfig.PubConfig.ToPublisher(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize publisher from config: %w", err)
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), publisherCloseTimeout)
+		defer cancel()
+		if err := pub.Close(closeCtx); err != nil {
+			log.Errorf("Failed to close publisher: %v", err)
+		}
+	}()
+	log.Infof("Backfilling packages created between %v and %v using %q publisher", since, until, pub.Name())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := []backfill.Result{}
+	for name, feed := range scheduledFeeds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := backfill.Run(ctx, name, feed, pub, since, until)
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, result)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Feed < results[j].Feed
+	})
+	incomplete := []string{}
+	for _, result := range results {
+		logger := log.WithFields(log.Fields{
+			"feed":          result.Feed,
+			"num_published": result.NumPublished,
+		})
+		if result.Complete(until) {
+			logger.Info("Backfilled the requested window")
+			continue
+		}
+		incomplete = append(incomplete, result.Feed)
+		for _, err := range result.Errs {
+			if errors.Is(err, backfill.ErrUnsupportedFeed) {
+				logger.Warn("Feed cannot cover the requested window, it only polls its most recent packages")
+				continue
+			}
+			logger.WithError(err).Error("Error backfilling feed")
+		}
+		logger.WithField("covered", result.Covered).Error("Feed did not cover the requested window")
+	}
+	if len(incomplete) > 0 {
+		return fmt.Errorf("%w: %s", errIncompleteBackfill, strings.Join(incomplete, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Command package-feeds runs one-off operations against the configured feeds.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ossf/package-feeds/pkg/config"
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+// publisherCloseTimeout bounds how long buffered messages are given to be
+// flushed by the publisher before exiting.
+const publisherCloseTimeout = 5 * time.Second
+
+var errUnknownFeed = errors.New("unknown feed")
+
+const usage = `Usage: package-feeds <command> [flags]
+
+Commands:
+  backfill  publish the packages created by feeds within a historical time window
+  poll      poll feeds once and write the packages as JSON lines
+
+Run 'package-feeds <command> -h' for the flags of a command.
+`
+
+func main() {
+	http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost = 8
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "backfill":
+		err = runBackfill(ctx, os.Args[2:])
+	case "poll":
+		err = runPoll(ctx, os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		stop()
+		log.Fatal(err)
+	}
+}
+
+// loadConfig reads the config file at configPath, or returns the default
+// configuration if configPath is empty.
+func loadConfig(configPath string) (*config.ScheduledFeedConfig, error) {
+	if configPath == "" {
+		log.Info("No config specified, using default configuration")
+		return config.Default(), nil
+	}
+	log.Infof("Using config from file: %v", configPath)
+	return config.FromFile(configPath)
+}
+
+// selectFeeds returns the configured feeds with the given comma separated names,
+// or all configured feeds if names is empty.
+func selectFeeds(appConfig *config.ScheduledFeedConfig, names string) (map[string]feeds.ScheduledFeed, error) {
+	scheduledFeeds, err := appConfig.GetScheduledFeeds()
+	if err != nil {
+		return nil, err
+	}
+	if names == "" {
+		return scheduledFeeds, nil
+	}
+	selected := map[string]feeds.ScheduledFeed{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		feed, ok := scheduledFeeds[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnknownFeed, name)
+		}
+		selected[name] = feed
+	}
+	return selected, nil
+}
+
+// parseTime parses s as either an RFC 3339 timestamp or a duration before now.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %q as a RFC 3339 timestamp or duration", s)
+	}
+	return now.Add(-d).UTC(), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+var errPollFailed = errors.New("feeds returned errors when polling")
+
+type feedPoll struct {
+	name     string
+	packages []*feeds.Package
+	errs     []error
+}
+
+func runPoll(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("poll", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("PACKAGE_FEEDS_CONFIG_PATH"), "path to the feeds config file")
+	feedNames := flags.String("feeds", "", "comma separated feeds to poll, defaults to all configured feeds")
+	sinceFlag := flags.String("since", "5m", "cutoff to poll from, as a RFC 3339 timestamp or a duration before now")
+	output := flags.String("output", "-", "file to write packages to as JSON lines, - writes to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	since, err := parseTime(*sinceFlag, time.Now())
+	if err != nil {
+		return err
+	}
+	appConfig, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	scheduledFeeds, err := selectFeeds(appConfig, *feedNames)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	log.Infof("Polling packages created since %v", since)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	polls := []feedPoll{}
+	for name, feed := range scheduledFeeds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pkgs, _, errs := feed.Latest(ctx, since)
+			mu.Lock()
+			defer mu.Unlock()
+			polls = append(polls, feedPoll{name: name, packages: pkgs, errs: errs})
+		}()
+	}
+	wg.Wait()
+
+	pkgs := []*feeds.Package{}
+	failed := []string{}
+	sort.Slice(polls, func(i, j int) bool {
+		return polls[i].name < polls[j].name
+	})
+	for _, p := range polls {
+		logger := log.WithField("feed", p.name)
+		for _, err := range p.errs {
+			logger.WithError(err).Error("Error fetching packages")
+		}
+		if len(p.errs) > 0 {
+			failed = append(failed, p.name)
+		}
+		logger.WithField("num_packages", len(p.packages)).Info("Polled packages")
+		pkgs = append(pkgs, p.packages...)
+	}
+	if err := writePackages(out, pkgs); err != nil {
+		return fmt.Errorf("failed to write packages: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", errPollFailed, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// writePackages writes packages in order of creation as JSON lines.
+func writePackages(w io.Writer, pkgs []*feeds.Package) error {
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		return pkgs[i].CreatedDate.Before(pkgs[j].CreatedDate)
+	})
+	enc := json.NewEncoder(w)
+	for _, pkg := range pkgs {
+		if err := enc.Encode(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
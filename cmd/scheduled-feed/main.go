@@ -4,7 +4,9 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -13,6 +15,10 @@ import (
 	"github.com/ossf/package-feeds/pkg/scheduler"
 )
 
+// publisherCloseTimeout bounds how long buffered messages are given to be
+// flushed by the publisher on shutdown.
+const publisherCloseTimeout = 5 * time.Second
+
 func main() {
 	// Increase idle conns per host to increase the reuse of existing
 	// connections between requests. This only applies to HTTP1. HTTP2 requests
@@ -41,6 +47,12 @@ func main() {
 	}
 	log.Infof("Using %q publisher", pub.Name())
 
+	store, err := appConfig.GetCheckpointStore(context.TODO())
+	if err != nil {
+		log.Fatalf("Failed to initialize checkpoint store from config: %v", err)
+	}
+	log.Infof("Using %q checkpoint store", store.Name())
+
 	scheduledFeeds, err := appConfig.GetScheduledFeeds()
 	feedNames := []string{}
 	for k := range scheduledFeeds {
@@ -55,9 +67,21 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to parse poll_rate to duration: %v", err)
 	}
-	sched := scheduler.New(scheduledFeeds, pub, appConfig.HTTPPort)
-	err = sched.Run(pollRate, appConfig.Timer)
+	// Stop polling gracefully on SIGTERM, as sent by Kubernetes during rolling
+	// deploys, or on SIGINT.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	sched := scheduler.New(scheduledFeeds, pub, store, appConfig.HTTPPort)
+	err = sched.Run(ctx, pollRate, appConfig.Timer)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), publisherCloseTimeout)
+	defer cancel()
+	if err := pub.Close(closeCtx); err != nil {
+		log.Errorf("Failed to close publisher: %v", err)
+	}
+	log.Info("Shutdown complete")
 }
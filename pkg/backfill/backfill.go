@@ -0,0 +1,126 @@
+// Package backfill replays the packages published to feeds within a historical
+// time window through a publisher.
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/publisher"
+)
+
+var ErrUnsupportedFeed = errors.New("feed does not support backfilling")
+
+// Result describes the backfill of a single feed.
+type Result struct {
+	Feed         string
+	NumPublished int
+
+	// Covered is the time up to which the requested window was backfilled, if it
+	// is before the end of the window the remainder of the window was not covered.
+	Covered time.Time
+	Errs    []error
+}
+
+// Complete returns true if the whole of the requested window was backfilled.
+func (r Result) Complete(until time.Time) bool {
+	return len(r.Errs) == 0 && !r.Covered.Before(until)
+}
+
+// Run publishes the packages created by the named feed after since, up to and
+// including until. Feeds which do not implement feeds.BackfillFeed return
+// ErrUnsupportedFeed as they can only poll their most recent packages.
+//
+//nolint:lll
+func Run(ctx context.Context, name string, feed feeds.ScheduledFeed, pub publisher.Publisher, since, until time.Time) Result {
+	result := Result{
+		Feed:    name,
+		Covered: since,
+	}
+	if bf, ok := feed.(feeds.BackfillFeed); !ok || !bf.SupportsBackfill() {
+		result.Errs = []error{fmt.Errorf("%w: %s", ErrUnsupportedFeed, name)}
+		return result
+	}
+
+	logger := log.WithField("feed", name)
+	cutoff := since
+	for cutoff.Before(until) {
+		pkgs, newCutoff, errs := feed.Latest(ctx, cutoff)
+		for _, err := range errs {
+			logger.WithError(err).Error("Error fetching packages")
+		}
+		result.Errs = append(result.Errs, errs...)
+
+		pkgs = inWindow(pkgs, cutoff, until)
+		numPublished, err := publishPackages(ctx, pub, pkgs)
+		result.NumPublished += numPublished
+		if err != nil {
+			result.Errs = append(result.Errs, err)
+			return result
+		}
+		logger.WithFields(log.Fields{
+			"num_packages": numPublished,
+			"cutoff":       newCutoff,
+		}).Print("Backfilled packages")
+
+		if ctx.Err() != nil {
+			result.Errs = append(result.Errs, ctx.Err())
+			return result
+		}
+		if !newCutoff.After(cutoff) {
+			if len(errs) == 0 {
+				// No newer packages are available, so the feed is caught up to the
+				// present.
+				cutoff = until
+			}
+			break
+		}
+		cutoff = newCutoff
+		result.Covered = minTime(cutoff, until)
+	}
+	result.Covered = minTime(cutoff, until)
+	return result
+}
+
+// inWindow returns the packages created after since, up to and including until.
+func inWindow(pkgs []*feeds.Package, since, until time.Time) []*feeds.Package {
+	filtered := []*feeds.Package{}
+	for _, pkg := range feeds.ApplyCutoff(pkgs, since) {
+		if !pkg.CreatedDate.After(until) {
+			filtered = append(filtered, pkg)
+		}
+	}
+	return filtered
+}
+
+// publishPackages publishes packages in order of creation, stopping at the first
+// package which fails to publish.
+func publishPackages(ctx context.Context, pub publisher.Publisher, pkgs []*feeds.Package) (int, error) {
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		return pkgs[i].CreatedDate.Before(pkgs[j].CreatedDate)
+	})
+	for i, pkg := range pkgs {
+		b, err := json.Marshal(pkg)
+		if err != nil {
+			return i, fmt.Errorf("failed to marshal package %s: %w", pkg.Name, err)
+		}
+		if err := pub.Send(ctx, b); err != nil {
+			return i, fmt.Errorf("failed to publish package %s: %w", pkg.Name, err)
+		}
+	}
+	return len(pkgs), nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,154 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+var errFetch = errors.New("error fetching packages")
+
+// pagedFeed returns at most pageSize of its packages created after the cutoff.
+type pagedFeed struct {
+	packages []*feeds.Package
+	pageSize int
+	errs     []error
+	backfill bool
+}
+
+func (feed pagedFeed) Latest(_ context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	pkgs := feeds.ApplyCutoff(feed.packages, cutoff)
+	if len(pkgs) > feed.pageSize {
+		pkgs = pkgs[:feed.pageSize]
+	}
+	return pkgs, feeds.FindCutoff(cutoff, pkgs), feed.errs
+}
+
+func (feed pagedFeed) GetName() string {
+	return "pagedFeed"
+}
+
+func (feed pagedFeed) GetFeedOptions() feeds.FeedOptions {
+	return feeds.FeedOptions{}
+}
+
+func (feed pagedFeed) SupportsBackfill() bool {
+	return feed.backfill
+}
+
+type recordingPublisher struct {
+	sent *[]string
+}
+
+func (pub recordingPublisher) Send(_ context.Context, body []byte) error {
+	*pub.sent = append(*pub.sent, string(body))
+	return nil
+}
+
+func (pub recordingPublisher) Name() string {
+	return "recording"
+}
+
+func (pub recordingPublisher) Close(_ context.Context) error {
+	return nil
+}
+
+func packagesEvery(start time.Time, interval time.Duration, n int) []*feeds.Package {
+	pkgs := []*feeds.Package{}
+	for i := 1; i <= n; i++ {
+		pkgs = append(pkgs, feeds.NewPackage(start.Add(time.Duration(i)*interval), "pkg", "1.0.0", "pagedFeed"))
+	}
+	return pkgs
+}
+
+func TestRunPagesThroughWindow(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	feed := pagedFeed{
+		packages: packagesEvery(start, time.Hour, 10),
+		pageSize: 3,
+		backfill: true,
+	}
+	sent := []string{}
+	until := start.Add(8 * time.Hour)
+
+	result := Run(context.Background(), "pagedFeed", feed, recordingPublisher{sent: &sent}, start.Add(time.Hour), until)
+	if len(result.Errs) != 0 {
+		t.Fatalf("Run() returned errors: %v", result.Errs)
+	}
+	// Packages created in hours 2 to 8 inclusive fall within the window.
+	if result.NumPublished != 7 || len(sent) != 7 {
+		t.Errorf("Run() published %v packages (%v sent), want 7", result.NumPublished, len(sent))
+	}
+	if !result.Complete(until) {
+		t.Errorf("Run() covered up to %v, want %v", result.Covered, until)
+	}
+}
+
+func TestRunCaughtUp(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	feed := pagedFeed{
+		packages: packagesEvery(start, time.Hour, 2),
+		pageSize: 3,
+		backfill: true,
+	}
+	sent := []string{}
+	until := start.Add(24 * time.Hour)
+
+	result := Run(context.Background(), "pagedFeed", feed, recordingPublisher{sent: &sent}, start, until)
+	if result.NumPublished != 2 {
+		t.Errorf("Run() published %v packages, want 2", result.NumPublished)
+	}
+	if !result.Complete(until) {
+		t.Errorf("Run() covered up to %v, want %v", result.Covered, until)
+	}
+}
+
+func TestRunFeedErrors(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	feed := pagedFeed{
+		pageSize: 3,
+		errs:     []error{errFetch},
+		backfill: true,
+	}
+	sent := []string{}
+	until := start.Add(24 * time.Hour)
+
+	result := Run(context.Background(), "pagedFeed", feed, recordingPublisher{sent: &sent}, start, until)
+	if result.Complete(until) {
+		t.Errorf("Run() reported a complete backfill for a failing feed")
+	}
+	if !result.Covered.Equal(start) {
+		t.Errorf("Run() covered up to %v, want %v", result.Covered, start)
+	}
+	if len(result.Errs) != 1 || !errors.Is(result.Errs[0], errFetch) {
+		t.Errorf("Run() returned errors %v, want [%v]", result.Errs, errFetch)
+	}
+}
+
+func TestRunUnsupportedFeed(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	feed := pagedFeed{
+		packages: packagesEvery(start, time.Hour, 2),
+		pageSize: 3,
+	}
+	sent := []string{}
+
+	result := Run(context.Background(), "pagedFeed", feed, recordingPublisher{sent: &sent}, start, start.Add(time.Hour))
+	if len(result.Errs) != 1 || !errors.Is(result.Errs[0], ErrUnsupportedFeed) {
+		t.Errorf("Run() returned errors %v, want [%v]", result.Errs, ErrUnsupportedFeed)
+	}
+	if len(sent) != 0 {
+		t.Errorf("Run() published %v packages for an unsupported feed", len(sent))
+	}
+}
@@ -0,0 +1,74 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/json"
+
+	"gocloud.dev/blob"
+	// Load blob drivers.
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/gcsblob"
+	_ "gocloud.dev/blob/memblob"
+	"gocloud.dev/gcerrors"
+
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+)
+
+const (
+	StoreType = "blob"
+)
+
+type Config struct {
+	URL string `mapstructure:"url"`
+}
+
+// BlobStore keeps the checkpoint of each feed as a separate JSON object
+// named after the feed in a gocloud blob bucket.
+type BlobStore struct {
+	bucket *blob.Bucket
+}
+
+func New(ctx context.Context, url string) (*BlobStore, error) {
+	bucket, err := blob.OpenBucket(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobStore{
+		bucket: bucket,
+	}, nil
+}
+
+func FromConfig(ctx context.Context, config Config) (*BlobStore, error) {
+	return New(ctx, config.URL)
+}
+
+func (s *BlobStore) Name() string {
+	return StoreType
+}
+
+func (s *BlobStore) Load(ctx context.Context, feed string) (checkpoint.Checkpoint, error) {
+	var c checkpoint.Checkpoint
+	data, err := s.bucket.ReadAll(ctx, objectKey(feed))
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return c, checkpoint.ErrNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+func (s *BlobStore) Save(ctx context.Context, feed string, c checkpoint.Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.bucket.WriteAll(ctx, objectKey(feed), data, &blob.WriterOptions{
+		ContentType: "application/json",
+	})
+}
+
+func objectKey(feed string) string {
+	return feed + ".json"
+}
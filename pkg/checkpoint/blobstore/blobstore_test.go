@@ -0,0 +1,36 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+)
+
+func TestBlobStoreRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	store, err := New(context.Background(), "mem://")
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+
+	_, err = store.Load(context.Background(), "pypi")
+	if !errors.Is(err, checkpoint.ErrNotFound) {
+		t.Fatalf("Load() on an empty bucket returned %v when ErrNotFound was expected", err)
+	}
+
+	cutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Save(context.Background(), "pypi", checkpoint.Checkpoint{Cutoff: cutoff}); err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+	c, err := store.Load(context.Background(), "pypi")
+	if err != nil {
+		t.Fatalf("Failed to load saved checkpoint: %v", err)
+	}
+	if !c.Cutoff.Equal(cutoff) {
+		t.Errorf("Loaded cutoff %v, want %v", c.Cutoff, cutoff)
+	}
+}
@@ -0,0 +1,48 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("no checkpoint found for feed")
+
+// Checkpoint records how far a feed has been polled.
+type Checkpoint struct {
+	Cutoff time.Time `json:"cutoff"`
+
+	// Cursor is the registry specific position of feeds which poll from a cursor,
+	// such as a sequence number, rather than from the cutoff.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Store persists a Checkpoint for each feed, allowing polling to resume from the
+// previous cutoff when the application is restarted.
+type Store interface {
+	// Load returns the checkpoint saved for the given feed, or ErrNotFound if
+	// the feed has no saved checkpoint.
+	Load(ctx context.Context, feed string) (Checkpoint, error)
+	Save(ctx context.Context, feed string, c Checkpoint) error
+	Name() string
+}
+
+type nullStore struct{}
+
+// NewNullStore returns a Store which never has a checkpoint to load and
+// discards any saved checkpoints.
+func NewNullStore() Store {
+	return nullStore{}
+}
+
+func (nullStore) Load(_ context.Context, _ string) (Checkpoint, error) {
+	return Checkpoint{}, ErrNotFound
+}
+
+func (nullStore) Save(_ context.Context, _ string, _ Checkpoint) error {
+	return nil
+}
+
+func (nullStore) Name() string {
+	return "null"
+}
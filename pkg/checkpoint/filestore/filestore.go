@@ -0,0 +1,93 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+)
+
+const (
+	StoreType = "file"
+)
+
+type Config struct {
+	Path string `mapstructure:"path"`
+}
+
+// FileStore keeps the checkpoints of all feeds in a single JSON file.
+type FileStore struct {
+	path string
+
+	mu          sync.Mutex
+	checkpoints map[string]checkpoint.Checkpoint
+}
+
+func New(path string) (*FileStore, error) {
+	store := &FileStore{
+		path:        path,
+		checkpoints: map[string]checkpoint.Checkpoint{},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.checkpoints); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func FromConfig(config Config) (*FileStore, error) {
+	return New(config.Path)
+}
+
+func (s *FileStore) Name() string {
+	return StoreType
+}
+
+func (s *FileStore) Load(_ context.Context, feed string) (checkpoint.Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.checkpoints[feed]
+	if !ok {
+		return checkpoint.Checkpoint{}, checkpoint.ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *FileStore) Save(_ context.Context, feed string, c checkpoint.Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[feed] = c
+	data, err := json.MarshalIndent(s.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it over the original, so a crash
+	// part way through writing can't leave a truncated checkpoint file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
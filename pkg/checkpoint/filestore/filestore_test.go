@@ -0,0 +1,44 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	store, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	_, err = store.Load(context.Background(), "npm")
+	if !errors.Is(err, checkpoint.ErrNotFound) {
+		t.Fatalf("Load() on an empty store returned %v when ErrNotFound was expected", err)
+	}
+
+	cutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Save(context.Background(), "npm", checkpoint.Checkpoint{Cutoff: cutoff}); err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	// A new store for the same path should see the saved checkpoint.
+	reopened, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	c, err := reopened.Load(context.Background(), "npm")
+	if err != nil {
+		t.Fatalf("Failed to load saved checkpoint: %v", err)
+	}
+	if !c.Cutoff.Equal(cutoff) {
+		t.Errorf("Loaded cutoff %v, want %v", c.Cutoff, cutoff)
+	}
+}
@@ -2,8 +2,10 @@ package config_test
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
+	"github.com/ossf/package-feeds/pkg/checkpoint/filestore"
 	"github.com/ossf/package-feeds/pkg/config"
 	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
@@ -27,6 +29,22 @@ publisher:
 http_port: 8080
 poll_rate: 5m
 timer: true
+`
+	TestConfigStrNamedFeeds = `
+feeds:
+- type: npm
+- name: npm-critical
+  type: npm
+  options:
+    packages:
+    - foo
+    poll_rate: 30s
+`
+	TestConfigStrDuplicateFeedName = `
+feeds:
+- type: npm
+- name: npm
+  type: npm
 `
 	TestConfigStrUnknownFeedType = `
 feeds:
@@ -62,7 +80,11 @@ func TestDefault(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to initialise publisher from config")
 	}
-	_ = scheduler.New(scheduledFeeds, pub, c.HTTPPort)
+	store, err := c.GetCheckpointStore(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to initialise checkpoint store from config")
+	}
+	_ = scheduler.New(scheduledFeeds, pub, store, c.HTTPPort)
 }
 
 func TestGetScheduledFeeds(t *testing.T) {
@@ -86,6 +108,48 @@ func TestGetScheduledFeeds(t *testing.T) {
 	}
 }
 
+func TestGetScheduledFeedsNamed(t *testing.T) {
+	t.Parallel()
+
+	c, err := config.NewConfigFromBytes([]byte(TestConfigStrNamedFeeds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduledFeeds, err := c.GetScheduledFeeds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scheduledFeeds) != 2 {
+		t.Fatalf("expected 2 scheduled feeds but got %v", len(scheduledFeeds))
+	}
+	if _, ok := scheduledFeeds["npm"]; !ok {
+		t.Error("expected unnamed feed to be registered by its type")
+	}
+	critical, ok := scheduledFeeds["npm-critical"]
+	if !ok {
+		t.Fatal("expected named feed to be registered by its name")
+	}
+	if critical.GetFeedOptions().PollRate != "30s" {
+		t.Errorf("named feed poll rate %q, want %q", critical.GetFeedOptions().PollRate, "30s")
+	}
+	if critical.GetFeedOptions().Name != "npm-critical" {
+		t.Errorf("named feed name %q, want %q", critical.GetFeedOptions().Name, "npm-critical")
+	}
+}
+
+func TestGetScheduledFeedsDuplicateName(t *testing.T) {
+	t.Parallel()
+
+	c, err := config.NewConfigFromBytes([]byte(TestConfigStrDuplicateFeedName))
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	_, err = c.GetScheduledFeeds()
+	if err == nil {
+		t.Error("duplicate feed names were successfully parsed when it should've failed")
+	}
+}
+
 func TestLoadFeedConfigUnknownFeedType(t *testing.T) {
 	t.Parallel()
 
@@ -155,6 +219,27 @@ func TestPublisherConfigToFeed(t *testing.T) {
 	}
 }
 
+func TestPublisherConfigToArtifactFeed(t *testing.T) {
+	t.Parallel()
+
+	c := config.FeedConfig{
+		Type: pypi.ArtifactFeedName,
+		Options: feeds.FeedOptions{
+			Packages: &[]string{"foo"},
+		},
+	}
+	feed, err := c.ToFeed(events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("failed to create pypi-artifacts feed from configuration: %v", err)
+	}
+	if _, ok := feed.(*pypi.ArtifactFeed); !ok {
+		t.Fatal("failed to cast feed as pypi-artifacts feed")
+	}
+	if feed.GetName() != pypi.ArtifactFeedName {
+		t.Errorf("feed name %q, want %q", feed.GetName(), pypi.ArtifactFeedName)
+	}
+}
+
 func TestStrictConfigDecoding(t *testing.T) {
 	t.Parallel()
 
@@ -206,3 +291,22 @@ func TestEventHandlerConfiguration(t *testing.T) {
 		t.Errorf("configured filter incorrectly rejects component `baz` from being dispatched")
 	}
 }
+
+func TestCheckpointConfigToStore(t *testing.T) {
+	t.Parallel()
+
+	c := config.CheckpointConfig{
+		Type: filestore.StoreType,
+		Config: map[string]interface{}{
+			"path": filepath.Join(t.TempDir(), "checkpoints.json"),
+		},
+	}
+	store, err := c.ToStore(context.TODO())
+	if err != nil {
+		t.Fatalf("failed to create file checkpoint store from config: %v", err)
+	}
+	if store.Name() != filestore.StoreType {
+		t.Errorf("file checkpoint config produced a store with an unexpected name: '%v' != '%v'",
+			store.Name(), filestore.StoreType)
+	}
+}
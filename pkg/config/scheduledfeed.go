@@ -13,6 +13,9 @@ import (
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+	"github.com/ossf/package-feeds/pkg/checkpoint/blobstore"
+	"github.com/ossf/package-feeds/pkg/checkpoint/filestore"
 	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/feeds/crates"
@@ -31,9 +34,11 @@ import (
 )
 
 var (
-	errUnknownFeed     = errors.New("unknown feed type")
-	errUnknownPub      = errors.New("unknown publisher type")
-	errUnknownSinkType = errors.New("unknown sink type")
+	errUnknownFeed      = errors.New("unknown feed type")
+	errDuplicateFeed    = errors.New("duplicate feed name")
+	errUnknownPub       = errors.New("unknown publisher type")
+	errUnknownSinkType  = errors.New("unknown sink type")
+	errUnknownStoreType = errors.New("unknown checkpoint store type")
 
 	// feed-specific poll rate is left unspecified, so it can still be
 	// configured by the global 'poll_rate' option in the ScheduledFeedConfig YAML.
@@ -90,7 +95,7 @@ func AddTo(ls *[]int, value int) {
 }
 
 // Constructs a map of ScheduledFeeds to enable based on the Feeds
-// provided from configuration, indexed by the feed type.
+// provided from configuration, indexed by the name of each feed.
 func (sc *ScheduledFeedConfig) GetScheduledFeeds() (map[string]feeds.ScheduledFeed, error) {
 	scheduledFeeds := map[string]feeds.ScheduledFeed{}
 	eventHandler, err := sc.GetEventHandler()
@@ -99,11 +104,15 @@ func (sc *ScheduledFeedConfig) GetScheduledFeeds() (map[string]feeds.ScheduledFe
 	}
 
 	for _, entry := range sc.Feeds {
+		name := entry.GetName()
+		if _, ok := scheduledFeeds[name]; ok {
+			return nil, fmt.Errorf("%w : %v", errDuplicateFeed, name)
+		}
 		feed, err := entry.ToFeed(eventHandler)
 		if err != nil {
 			return nil, err
 		}
-		scheduledFeeds[entry.Type] = feed
+		scheduledFeeds[name] = feed
 	}
 
 	return scheduledFeeds, nil
@@ -133,6 +142,39 @@ func (ec *EventsConfig) ToEventHandler() (*events.Handler, error) {
 	return events.NewHandler(sink, ec.EventFilter), nil
 }
 
+// Produces the checkpoint Store described by the CheckpointConfig, if no checkpoint
+// store is configured then checkpoints are not persisted.
+func (sc *ScheduledFeedConfig) GetCheckpointStore(ctx context.Context) (checkpoint.Store, error) {
+	if sc.CheckpointConfig == nil {
+		return checkpoint.NewNullStore(), nil
+	}
+	return sc.CheckpointConfig.ToStore(ctx)
+}
+
+// Produces a checkpoint Store from the provided CheckpointConfig. If the type is not
+// a recognised Store type, an error is returned.
+func (cc CheckpointConfig) ToStore(ctx context.Context) (checkpoint.Store, error) {
+	var err error
+	switch cc.Type {
+	case filestore.StoreType:
+		var fileConfig filestore.Config
+		err = strictDecode(cc.Config, &fileConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode file checkpoint config: %w", err)
+		}
+		return filestore.FromConfig(fileConfig)
+	case blobstore.StoreType:
+		var blobConfig blobstore.Config
+		err = strictDecode(cc.Config, &blobConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode blob checkpoint config: %w", err)
+		}
+		return blobstore.FromConfig(ctx, blobConfig)
+	default:
+		return nil, fmt.Errorf("%w : %v", errUnknownStoreType, cc.Type)
+	}
+}
+
 // Produces a Publisher object from the provided PublisherConfig
 // The PublisherConfig.Type value is evaluated and the appropriate Publisher is
 // constructed from the Config field. If the type is not a recognised Publisher type,
@@ -169,26 +211,45 @@ func (pc PublisherConfig) ToPublisher(ctx context.Context) (publisher.Publisher,
 	}
 }
 
+// GetName returns the configured name of the feed, or the feed type if the feed
+// is not named.
+func (fc FeedConfig) GetName() string {
+	if fc.Name == "" {
+		return fc.Type
+	}
+	return fc.Name
+}
+
 // Constructs the appropriate feed for the given type, providing the
 // options to the feed.
 func (fc FeedConfig) ToFeed(eventHandler *events.Handler) (feeds.ScheduledFeed, error) {
+	options := fc.Options
+	options.Name = fc.GetName()
 	switch fc.Type {
 	case crates.FeedName:
-		return crates.New(fc.Options, eventHandler)
+		return crates.New(options, eventHandler)
+	case crates.IndexFeedName:
+		return crates.NewIndexFeed(options, eventHandler)
 	case goproxy.FeedName:
-		return goproxy.New(fc.Options)
+		return goproxy.New(options, eventHandler)
 	case npm.FeedName:
-		return npm.New(fc.Options, eventHandler)
+		return npm.New(options, eventHandler)
+	case npm.ChangesFeedName:
+		return npm.NewChangesFeed(options)
 	case nuget.FeedName:
-		return nuget.New(fc.Options)
+		return nuget.New(options)
 	case maven.FeedName:
-		return maven.New(fc.Options)
+		return maven.New(options, eventHandler)
+	case maven.RepositoryFeedName:
+		return maven.NewRepositoryFeed(options)
 	case pypi.FeedName:
-		return pypi.New(fc.Options, eventHandler)
+		return pypi.New(options, eventHandler)
+	case pypi.ArtifactFeedName:
+		return pypi.NewArtifactFeed(options, eventHandler)
 	case packagist.FeedName:
-		return packagist.New(fc.Options)
+		return packagist.New(options)
 	case rubygems.FeedName:
-		return rubygems.New(fc.Options, eventHandler)
+		return rubygems.New(options, eventHandler)
 	default:
 		return nil, fmt.Errorf("%w : %v", errUnknownFeed, fc.Type)
 	}
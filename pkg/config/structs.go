@@ -19,6 +19,9 @@ type ScheduledFeedConfig struct {
 	// Configures the EventHandler instance to be used throughout the package-feeds application.
 	EventsConfig *EventsConfig `yaml:"events"`
 
+	// Configures where the cutoff of each feed is persisted between restarts.
+	CheckpointConfig *CheckpointConfig `yaml:"checkpoint"`
+
 	eventHandler *events.Handler
 }
 
@@ -27,7 +30,15 @@ type PublisherConfig struct {
 	Config interface{} `mapstructure:"config"`
 }
 
+type CheckpointConfig struct {
+	Type   string      `mapstructure:"type"`
+	Config interface{} `mapstructure:"config"`
+}
+
 type FeedConfig struct {
+	// Name identifies the feed in logs, metrics and checkpoints, allowing several
+	// feeds of the same type to be configured. It defaults to the feed type.
+	Name    string            `mapstructure:"name"`
 	Type    string            `mapstructure:"type"`
 	Options feeds.FeedOptions `mapstructure:"options"`
 }
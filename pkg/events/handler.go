@@ -2,7 +2,8 @@ package events
 
 const (
 	// Event Types.
-	LossyFeedEventType = "LOSSY_FEED"
+	LossyFeedEventType  = "LOSSY_FEED"
+	NewProjectEventType = "NEW_PROJECT"
 
 	// Components.
 	FeedsComponentType = "Feeds"
@@ -61,6 +62,7 @@ func NewFilter(enabledEventTypes, disabledEventTypes, enabledComponents []string
 
 // Dispatches an event to the configured sink if it passes the configured filter.
 func (h *Handler) DispatchEvent(e Event) error {
+	eventsDispatched.WithLabelValues(e.GetType(), e.GetComponent()).Inc()
 	if h.eventSink == nil {
 		return nil
 	}
@@ -0,0 +1,12 @@
+package events
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var eventsDispatched = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "package_feeds",
+	Name:      "events_dispatched_total",
+	Help:      "Number of events dispatched to an event handler, before filtering.",
+}, []string{"type", "component"})
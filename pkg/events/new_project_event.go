@@ -0,0 +1,24 @@
+package events
+
+import (
+	"fmt"
+)
+
+// NewProjectEvent is dispatched for the first release of a brand-new project.
+type NewProjectEvent struct {
+	Feed    string
+	Name    string
+	Version string
+}
+
+func (e NewProjectEvent) GetComponent() string {
+	return FeedsComponentType
+}
+
+func (e NewProjectEvent) GetType() string {
+	return NewProjectEventType
+}
+
+func (e NewProjectEvent) GetMessage() string {
+	return fmt.Sprintf("new project %v released version %v in %v feed", e.Name, e.Version, e.Feed)
+}
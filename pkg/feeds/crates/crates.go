@@ -1,6 +1,7 @@
 package crates
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -25,6 +26,7 @@ var httpClient = &http.Client{
 
 type crates struct {
 	JustUpdated []*Package `json:"just_updated"`
+	NewCrates   []*Package `json:"new_crates"`
 }
 
 // Package stores the information from crates.io updates.
@@ -38,12 +40,26 @@ type Package struct {
 }
 
 // Gets crates.io packages.
-func fetchPackages(baseURL string) ([]*Package, error) {
+func fetchPackages(ctx context.Context, baseURL string) ([]*Package, error) {
+	v, err := fetchSummary(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	// TODO: We should check both the NewCrates as well.
+	return v.JustUpdated, nil
+}
+
+// fetchSummary gets the recently updated and newly created crates.
+func fetchSummary(ctx context.Context, baseURL string) (*crates, error) {
 	pkgURL, err := url.JoinPath(baseURL, activityPath)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := httpClient.Get(pkgURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pkgURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -59,8 +75,7 @@ func fetchPackages(baseURL string) ([]*Package, error) {
 	if err != nil {
 		return nil, err
 	}
-	// TODO: We should check both the NewCrates as well.
-	return v.JustUpdated, nil
+	return v, nil
 }
 
 type Feed struct {
@@ -83,9 +98,9 @@ func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, er
 	}, nil
 }
 
-func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+func (feed Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
 	pkgs := []*feeds.Package{}
-	packages, err := fetchPackages(feed.baseURL)
+	packages, err := fetchPackages(ctx, feed.baseURL)
 	if err != nil {
 		return pkgs, cutoff, []error{err}
 	}
@@ -93,7 +108,7 @@ func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
 		pkg := feeds.NewPackage(pkg.UpdatedAt, pkg.Name, pkg.NewestVersion, FeedName)
 		pkgs = append(pkgs, pkg)
 	}
-	feed.lossyFeedAlerter.ProcessPackages(FeedName, pkgs)
+	feed.lossyFeedAlerter.ProcessPackages(feed.options.InstanceName(FeedName), pkgs)
 
 	newCutoff := feeds.FindCutoff(cutoff, pkgs)
 	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
@@ -1,6 +1,7 @@
 package crates
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"testing"
@@ -27,7 +28,7 @@ func TestCratesLatest(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("feed.Latest returned error: %v", err)
 	}
@@ -73,7 +74,7 @@ func TestCratesNotFound(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	_, gotCutoff, errs := feed.Latest(cutoff)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if cutoff != gotCutoff {
 		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
 	}
@@ -0,0 +1,349 @@
+package crates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/ossf/package-feeds/pkg/events"
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+const (
+	IndexFeedName = "crates-index"
+
+	// indexStateLimit defines how many crates have the versions listed by their
+	// index file remembered between polls.
+	indexStateLimit = 10000
+	// indexWorkers defines how many index files are fetched concurrently.
+	indexWorkers = 10
+)
+
+// IndexEntry is a line of a crate's file in the sparse index, describing a
+// single version of the crate.
+type IndexEntry struct {
+	Name     string `json:"name"`
+	Version  string `json:"vers"`
+	Checksum string `json:"cksum"`
+	Yanked   bool   `json:"yanked"`
+	// PubTime is only recorded for versions published since the field was
+	// introduced to the index.
+	PubTime time.Time `json:"pubtime"`
+}
+
+// indexFile is a crate's file in the sparse index.
+type indexFile struct {
+	entries      []IndexEntry
+	etag         string
+	lastModified time.Time
+}
+
+// indexState records the versions listed by a crate's index file at the
+// previous poll, mapped to whether the version was yanked.
+type indexState struct {
+	etag     string
+	versions map[string]bool
+}
+
+// indexPath returns the path of a crate's file in the sparse index, which is
+// determined by the length and leading characters of the lowercased name.
+func indexPath(name string) string {
+	name = strings.ToLower(name)
+	switch len(name) {
+	case 1:
+		return "1/" + name
+	case 2:
+		return "2/" + name
+	case 3:
+		return "3/" + name[:1] + "/" + name
+	default:
+		return name[:2] + "/" + name[2:4] + "/" + name
+	}
+}
+
+// fetchIndexFile fetches a crate's file from the sparse index. If the file has
+// not been modified since it was fetched with the given ETag, nil is returned.
+func fetchIndexFile(ctx context.Context, indexURL, name, etag string) (*indexFile, error) {
+	fileURL, err := url.JoinPath(indexURL, indexPath(name))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if err := utils.CheckResponseStatus(resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch crates index file: %w", err)
+	}
+
+	file := &indexFile{etag: resp.Header.Get("ETag")}
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		entry := IndexEntry{}
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("error decoding crates index file: %w", err)
+		}
+		file.entries = append(file.entries, entry)
+	}
+
+	file.lastModified, err = http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		file.lastModified = time.Now().UTC()
+	}
+	return file, nil
+}
+
+// IndexFeed polls crates.io using the sparse index, which lists every version of
+// a crate along with its checksum and yanked state. Without the packages option
+// the crates to poll are taken from the recently updated and newly created
+// crates listed by the summary API.
+type IndexFeed struct {
+	lossyFeedAlerter *feeds.LossyFeedAlerter
+	baseURL          string
+	indexURL         string
+	packages         *[]string
+	options          feeds.FeedOptions
+
+	// states records the index file of each crate seen by previous polls.
+	states *lru.Cache[string, *indexState]
+}
+
+func NewIndexFeed(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*IndexFeed, error) {
+	states, err := lru.New[string, *indexState](indexStateLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexFeed{
+		lossyFeedAlerter: feeds.NewLossyFeedAlerter(eventHandler),
+		baseURL:          "https://crates.io",
+		indexURL:         "https://index.crates.io/",
+		packages:         feedOptions.Packages,
+		options:          feedOptions,
+		states:           states,
+	}, nil
+}
+
+// diff compares a crate's index file with the one seen by the previous poll,
+// returning the versions which were added along with events for versions which
+// were yanked or unyanked. Changes whose time is not recorded in the index are
+// created at the given time.
+func (feed *IndexFeed) diff(name string, file *indexFile, created, cutoff time.Time) []*feeds.Package {
+	key := strings.ToLower(name)
+	prev, seen := feed.states.Get(key)
+	state := &indexState{etag: file.etag, versions: map[string]bool{}}
+	for _, entry := range file.entries {
+		state.versions[entry.Version] = entry.Yanked
+	}
+	feed.states.Add(key, state)
+
+	pkgs := []*feeds.Package{}
+	for i, entry := range file.entries {
+		published := entry.PubTime
+		if seen {
+			if yanked, ok := prev.versions[entry.Version]; ok {
+				if yanked != entry.Yanked {
+					pkgs = append(pkgs, newYankEvent(created, entry))
+				}
+				continue
+			}
+		} else {
+			// The first time a crate is seen only the versions published after the
+			// cutoff are returned. When the index does not record the publish time,
+			// only the most recent version is returned.
+			if published.IsZero() && i == len(file.entries)-1 {
+				published = created
+			}
+			if !published.After(cutoff) {
+				continue
+			}
+		}
+
+		if published.IsZero() {
+			published = created
+		}
+		pkg := feeds.NewPackage(published, entry.Name, entry.Version, IndexFeedName)
+		pkg.Checksum = "sha256:" + entry.Checksum
+		pkgs = append(pkgs, pkg)
+		if entry.Yanked {
+			pkgs = append(pkgs, newYankEvent(created, entry))
+		}
+	}
+	return pkgs
+}
+
+// record adds a version returned without fetching a crate's index file to the
+// state of the crate, so that it is not returned again once the index file is
+// fetched. It returns false if the version was already seen. The state of a crate
+// which was not seen before is left unset, as the next time its index file is
+// fetched only the versions published after the cutoff are returned, and the
+// cutoff has advanced past the time the crate was updated.
+func (feed *IndexFeed) record(name, version string) bool {
+	key := strings.ToLower(name)
+	prev, seen := feed.states.Get(key)
+	if !seen {
+		return true
+	}
+	if _, ok := prev.versions[version]; ok {
+		return false
+	}
+	// The etag is cleared so that the index file is fetched in full.
+	state := &indexState{versions: maps.Clone(prev.versions)}
+	state.versions[version] = false
+	feed.states.Add(key, state)
+	return true
+}
+
+func newYankEvent(created time.Time, entry IndexEntry) *feeds.Package {
+	event := feeds.UnyankEvent
+	if entry.Yanked {
+		event = feeds.YankEvent
+	}
+	return feeds.NewPackageEvent(created, entry.Name, entry.Version, event, IndexFeedName)
+}
+
+// pollCrate returns the changes to a crate's index file since the previous
+// poll. Changes are created at the time the crate was updated, or the time the
+// index file was last modified if the crate was not listed by the summary API.
+// If the index file cannot be fetched, the newest version listed by the summary
+// API is returned alongside the error, unless it was returned before.
+func (feed *IndexFeed) pollCrate(ctx context.Context, crate *Package, cutoff time.Time) ([]*feeds.Package, error) {
+	etag := ""
+	if state, ok := feed.states.Get(strings.ToLower(crate.Name)); ok {
+		etag = state.etag
+	}
+	file, err := fetchIndexFile(ctx, feed.indexURL, crate.Name, etag)
+	if err != nil {
+		pkgs := []*feeds.Package{}
+		listed := crate.NewestVersion != "" && crate.UpdatedAt.After(cutoff)
+		if listed && feed.record(crate.Name, crate.NewestVersion) {
+			pkgs = append(pkgs, feeds.NewPackage(crate.UpdatedAt, crate.Name, crate.NewestVersion, IndexFeedName))
+		}
+		return pkgs, feeds.PackagePollError{Name: crate.Name, Err: err}
+	}
+	if file == nil {
+		return []*feeds.Package{}, nil
+	}
+
+	created := crate.UpdatedAt
+	if created.IsZero() {
+		created = file.lastModified
+	}
+	return feed.diff(crate.Name, file, created, cutoff), nil
+}
+
+// pollCrates polls the index file of each of the given crates concurrently.
+func (feed *IndexFeed) pollCrates(
+	ctx context.Context, candidates []*Package, cutoff time.Time,
+) ([]*feeds.Package, []error) {
+	results := make([][]*feeds.Package, len(candidates))
+	resultErrs := make([]error, len(candidates))
+	sem := make(chan struct{}, indexWorkers)
+	var wg sync.WaitGroup
+	for i, crate := range candidates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], resultErrs[i] = feed.pollCrate(ctx, crate, cutoff)
+		}()
+	}
+	wg.Wait()
+
+	pkgs := []*feeds.Package{}
+	errs := []error{}
+	for i := range candidates {
+		pkgs = append(pkgs, results[i]...)
+		if resultErrs[i] != nil {
+			errs = append(errs, resultErrs[i])
+		}
+	}
+	return pkgs, errs
+}
+
+// latestSummary polls the index files of the crates which the summary API lists
+// as updated or created since the cutoff.
+func (feed *IndexFeed) latestSummary(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	summary, err := fetchSummary(ctx, feed.baseURL)
+	if err != nil {
+		return []*feeds.Package{}, cutoff, []error{err}
+	}
+
+	listed := []*feeds.Package{}
+	for _, crate := range summary.JustUpdated {
+		listed = append(listed, feeds.NewPackage(crate.UpdatedAt, crate.Name, crate.NewestVersion, IndexFeedName))
+	}
+	feed.lossyFeedAlerter.ProcessPackages(feed.options.InstanceName(IndexFeedName), listed)
+
+	// Newly created crates are usually also listed as just updated.
+	candidates := []*Package{}
+	seen := map[string]bool{}
+	newCutoff := cutoff
+	for _, crate := range append(summary.JustUpdated, summary.NewCrates...) {
+		if crate.UpdatedAt.After(newCutoff) {
+			newCutoff = crate.UpdatedAt
+		}
+		if seen[crate.Name] || !crate.UpdatedAt.After(cutoff) {
+			continue
+		}
+		seen[crate.Name] = true
+		candidates = append(candidates, crate)
+	}
+
+	pkgs, errs := feed.pollCrates(ctx, candidates, cutoff)
+	return pkgs, newCutoff, errs
+}
+
+// latestPackages polls the index files of the crates set by the packages option.
+func (feed *IndexFeed) latestPackages(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	candidates := []*Package{}
+	for _, name := range *feed.packages {
+		candidates = append(candidates, &Package{Name: name})
+	}
+
+	pkgs, errs := feed.pollCrates(ctx, candidates, cutoff)
+	if len(errs) == len(candidates) && len(errs) != 0 {
+		// If none of the crates were successfully polled for, return early.
+		return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
+	}
+	return pkgs, feeds.FindCutoff(cutoff, pkgs), errs
+}
+
+// Latest returns the versions published, yanked or unyanked since the previous
+// poll. Every version of a crate is compared, so versions published between
+// polls are not missed when the crate is updated again before the next poll.
+func (feed *IndexFeed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	if feed.packages != nil {
+		return feed.latestPackages(ctx, cutoff)
+	}
+	return feed.latestSummary(ctx, cutoff)
+}
+
+func (feed *IndexFeed) GetName() string {
+	return IndexFeedName
+}
+
+func (feed *IndexFeed) GetFeedOptions() feeds.FeedOptions {
+	return feed.options
+}
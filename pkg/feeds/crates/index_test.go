@@ -0,0 +1,277 @@
+package crates
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/events"
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+	testutils "github.com/ossf/package-feeds/pkg/utils/test"
+)
+
+// indexFileMock serves a crate's index file, which may be changed between polls.
+type indexFileMock struct {
+	mu   sync.Mutex
+	body string
+	etag string
+}
+
+func (m *indexFileMock) set(body, etag string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.body = body
+	m.etag = etag
+}
+
+func (m *indexFileMock) handle(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.Header.Get("If-None-Match") == m.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", m.etag)
+	w.Header().Set("Last-Modified", "Fri, 19 Mar 2021 13:40:00 GMT")
+	if _, err := w.Write([]byte(m.body)); err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
+func TestIndexPath(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"a":          "1/a",
+		"ab":         "2/ab",
+		"abc":        "3/a/abc",
+		"FooPackage": "fo/op/foopackage",
+		"serde_json": "se/rd/serde_json",
+	}
+	for name, want := range tests {
+		if got := indexPath(name); got != want {
+			t.Errorf("indexPath(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestIndexFeedLatest(t *testing.T) {
+	t.Parallel()
+
+	foo := &indexFileMock{}
+	foo.set(`{"name":"FooPackage","vers":"0.1.0","cksum":"aa","yanked":false}
+{"name":"FooPackage","vers":"0.2.0","cksum":"bb","yanked":false}
+`, `"foo-1"`)
+	bar := &indexFileMock{}
+	bar.set(`{"name":"BarPackage","vers":"0.1.1","cksum":"cc","yanked":false,"pubtime":"2021-03-19T13:17:25Z"}
+`, `"bar-1"`)
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		activityPath:              cratesSummaryResponse,
+		"/index/fo/op/foopackage": foo.handle,
+		"/index/ba/rp/barpackage": bar.handle,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := NewIndexFeed(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create crates index feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+	feed.indexURL = srv.URL + "/index/"
+
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+
+	wantCutoff := time.Date(2021, 3, 19, 13, 36, 33, 0, time.UTC)
+	if gotCutoff.Sub(wantCutoff).Abs() > time.Second {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+
+	// The first poll only returns the most recent version of a crate whose index
+	// does not record publish times.
+	want := []string{"FooPackage@0.2.0", "BarPackage@0.1.1"}
+	if len(pkgs) != len(want) {
+		t.Fatalf("Latest() returned %d packages, want %d", len(pkgs), len(want))
+	}
+	for i, pkg := range pkgs {
+		if got := pkg.Name + "@" + pkg.Version; got != want[i] {
+			t.Errorf("Latest() package %d = %s, want %s", i, got, want[i])
+		}
+		if pkg.Type != IndexFeedName {
+			t.Errorf("Feed type not set correctly in crates package following Latest()")
+		}
+	}
+	if pkgs[0].Checksum != "sha256:bb" {
+		t.Errorf("Latest() checksum %q, want %q", pkgs[0].Checksum, "sha256:bb")
+	}
+	wantCreated := time.Date(2021, 3, 19, 13, 17, 25, 0, time.UTC)
+	if !pkgs[1].CreatedDate.Equal(wantCreated) {
+		t.Errorf("Latest() created %v, want the publish time %v", pkgs[1].CreatedDate, wantCreated)
+	}
+
+	// A version published and another yanked between polls are both returned,
+	// while the unmodified index file of BarPackage returns nothing.
+	foo.set(`{"name":"FooPackage","vers":"0.1.0","cksum":"aa","yanked":true}
+{"name":"FooPackage","vers":"0.2.0","cksum":"bb","yanked":false}
+{"name":"FooPackage","vers":"0.2.1","cksum":"dd","yanked":false}
+`, `"foo-2"`)
+	pkgs, _, errs = feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("Latest() returned %d packages, want 2", len(pkgs))
+	}
+	if pkgs[0].Version != "0.1.0" || pkgs[0].Event != feeds.YankEvent {
+		t.Errorf("Latest() returned %s %s, want a yank of 0.1.0", pkgs[0].Version, pkgs[0].Event)
+	}
+	if pkgs[1].Version != "0.2.1" || pkgs[1].Event != "" || pkgs[1].Checksum != "sha256:dd" {
+		t.Errorf("Latest() returned %s %s, want the new version 0.2.1", pkgs[1].Version, pkgs[1].Event)
+	}
+}
+
+func TestIndexFeedLatestPackages(t *testing.T) {
+	t.Parallel()
+
+	serde := &indexFileMock{}
+	serde.set(`{"name":"serde","vers":"1.0.0","cksum":"aa","yanked":false,"pubtime":"2021-03-01T00:00:00Z"}
+{"name":"serde","vers":"1.0.1","cksum":"bb","yanked":true,"pubtime":"2021-03-02T00:00:00Z"}
+`, `"serde-1"`)
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/se/rd/serde": serde.handle,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	packages := []string{"serde"}
+	feed, err := NewIndexFeed(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create crates index feed: %v", err)
+	}
+	feed.indexURL = srv.URL
+
+	cutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+
+	// Only the version published after the cutoff is returned, followed by its
+	// yanked state.
+	if len(pkgs) != 2 {
+		t.Fatalf("Latest() returned %d packages, want 2", len(pkgs))
+	}
+	if pkgs[0].Version != "1.0.1" || pkgs[0].Event != "" {
+		t.Errorf("Latest() returned %s %s, want the new version 1.0.1", pkgs[0].Version, pkgs[0].Event)
+	}
+	if pkgs[1].Version != "1.0.1" || pkgs[1].Event != feeds.YankEvent {
+		t.Errorf("Latest() returned %s %s, want a yank of 1.0.1", pkgs[1].Version, pkgs[1].Event)
+	}
+	wantCutoff := time.Date(2021, 3, 19, 13, 40, 0, 0, time.UTC)
+	if !gotCutoff.Equal(wantCutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+}
+
+func TestIndexFeedIndexNotFound(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		activityPath: cratesSummaryResponse,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := NewIndexFeed(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create crates index feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+	feed.indexURL = srv.URL + "/index/"
+
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 2 {
+		t.Fatalf("feed.Latest() returned %d errors, want 2", len(errs))
+	}
+	if !errors.Is(errs[0], utils.ErrUnsuccessfulRequest) {
+		t.Errorf("feed.Latest() returned an error which did not match the expected error")
+	}
+
+	// The newest versions listed by the summary are returned instead.
+	if len(pkgs) != 2 {
+		t.Fatalf("Latest() returned %d packages, want 2", len(pkgs))
+	}
+	if pkgs[0].Version != "0.2.0" || pkgs[1].Version != "0.1.1" {
+		t.Errorf("Latest() returned versions %s and %s, want 0.2.0 and 0.1.1", pkgs[0].Version, pkgs[1].Version)
+	}
+}
+
+func TestIndexFeedIndexUnavailable(t *testing.T) {
+	t.Parallel()
+
+	foo := &indexFileMock{}
+	foo.set(`{"name":"FooPackage","vers":"0.1.0","cksum":"aa","yanked":false}
+`, `"foo-1"`)
+	bar := &indexFileMock{}
+	bar.set(`{"name":"BarPackage","vers":"0.1.1","cksum":"cc","yanked":false,"pubtime":"2021-03-19T13:17:25Z"}
+`, `"bar-1"`)
+	var unavailable atomic.Bool
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		activityPath: cratesSummaryResponse,
+		"/index/fo/op/foopackage": func(w http.ResponseWriter, r *http.Request) {
+			if unavailable.Load() {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			foo.handle(w, r)
+		},
+		"/index/ba/rp/barpackage": bar.handle,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := NewIndexFeed(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create crates index feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+	feed.indexURL = srv.URL + "/index/"
+
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, _, errs := feed.Latest(context.Background(), cutoff); len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+
+	// While the index file is unavailable, the newest version listed by the
+	// summary is returned in its place.
+	unavailable.Store(true)
+	foo.set(`{"name":"FooPackage","vers":"0.1.0","cksum":"aa","yanked":false}
+{"name":"FooPackage","vers":"0.2.0","cksum":"bb","yanked":false}
+`, `"foo-2"`)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 1 {
+		t.Fatalf("feed.Latest returned errors %v, want 1", errs)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "FooPackage" || pkgs[0].Version != "0.2.0" {
+		t.Fatalf("Latest() returned %v, want FooPackage 0.2.0", pkgs)
+	}
+
+	// The version is not returned again once the index file is available.
+	unavailable.Store(false)
+	pkgs, _, errs = feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 0 {
+		t.Errorf("Latest() returned %v, want no packages", pkgs)
+	}
+}
@@ -1,17 +1,38 @@
 package feeds
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 )
 
 const (
-	schemaVer = "1.1"
+	schemaVer = "1.6"
 
 	DefaultUserAgent = "package-feeds (github.com/ossf/package-feeds)"
 )
 
+// Package events describe a change to an existing package version, packages
+// without an event are newly published versions.
+const (
+	// DeleteEvent is a version which has been deleted from the registry.
+	DeleteEvent = "delete"
+	// YankEvent is a version which has been yanked, it remains available to
+	// existing users but should no longer be newly depended upon.
+	YankEvent = "yank"
+	// UnyankEvent is a previously yanked version which has been restored.
+	UnyankEvent = "unyank"
+	// UnpublishEvent is a version which was removed along with every other
+	// version of the package, when the package itself was removed.
+	UnpublishEvent = "unpublish"
+	// DeprecateEvent is a version which has been marked as deprecated.
+	DeprecateEvent = "deprecate"
+	// DowngradeEvent is a version which has become the default version of the
+	// package although a newer version remains available.
+	DowngradeEvent = "downgrade"
+)
+
 var ErrNoPackagesPolled = errors.New("no packages were successfully polled")
 
 type UnsupportedOptionError struct {
@@ -20,19 +41,55 @@ type UnsupportedOptionError struct {
 }
 
 type ScheduledFeed interface {
-	Latest(cutoff time.Time) ([]*Package, time.Time, []error)
+	Latest(ctx context.Context, cutoff time.Time) ([]*Package, time.Time, []error)
 	GetFeedOptions() FeedOptions
 	GetName() string
 }
 
+// CursorFeed is implemented by feeds which poll from a registry specific cursor,
+// such as a sequence number, rather than the cutoff. The cursor is advanced by
+// Latest and is persisted once the polled packages have been published.
+type CursorFeed interface {
+	ScheduledFeed
+	// Cursor returns the position the next call to Latest will poll from.
+	Cursor() string
+	// SetCursor sets the position the next call to Latest will poll from.
+	SetCursor(cursor string)
+}
+
+// BackfillFeed is implemented by feeds which can poll packages since an arbitrary
+// cutoff in the past. Repeatedly calling Latest with the returned cutoff pages
+// through all packages created since the initial cutoff.
+type BackfillFeed interface {
+	ScheduledFeed
+	SupportsBackfill() bool
+}
+
 // General configuration options for feeds.
 type FeedOptions struct {
 	// A collection of package names to poll instead of standard firehose behaviour.
 	// Not supported by all feeds.
-	Packages *[]string `yaml:"packages"`
+	Packages *[]string `yaml:"packages" json:"packages,omitempty"`
+
+	// The URL of the repository to poll, for feeds which support mirrors or
+	// self-hosted repositories. Not supported by all feeds.
+	URL string `yaml:"url" json:"url,omitempty"`
 
 	// Cron string for scheduling the polling for the feed.
-	PollRate string `yaml:"poll_rate"`
+	PollRate string `yaml:"poll_rate" json:"poll_rate,omitempty"`
+
+	// The configured name of the feed, which is set from the name of the feed's
+	// configuration rather than its options.
+	Name string `yaml:"-" json:"-"`
+}
+
+// InstanceName returns the configured name of the feed, which identifies the feed
+// in events, logs and metrics, or feedType if the feed was not given a name.
+func (o FeedOptions) InstanceName(feedType string) string {
+	if o.Name == "" {
+		return feedType
+	}
+	return o.Name
 }
 
 // Marshalled json output validated against package.schema.json.
@@ -42,7 +99,26 @@ type Package struct {
 	CreatedDate time.Time `json:"created_date"`
 	Type        string    `json:"type"`
 	ArtifactID  string    `json:"artifact_id"`
-	SchemaVer   string    `json:"schema_ver"`
+	// ArtifactURL is the URL the version's artifact is downloaded from, when known.
+	ArtifactURL string `json:"artifact_url,omitempty"`
+	// Checksum of the version's artifact, formatted as the name of the hash
+	// algorithm and the hex encoded digest separated by a colon, when known.
+	Checksum string `json:"checksum,omitempty"`
+	// Integrity is the Subresource Integrity string of the version's artifact,
+	// when known.
+	Integrity string `json:"integrity,omitempty"`
+	// InstallScripts is set for versions which run scripts when installed, when
+	// the feed is able to detect it.
+	InstallScripts bool `json:"install_scripts,omitempty"`
+	// RequiresPython is the Python version specifier of a PyPI artifact, when known.
+	RequiresPython string `json:"requires_python,omitempty"`
+	// FirstRelease is set for the first release of a brand-new package, when the
+	// feed is able to detect it.
+	FirstRelease bool `json:"first_release,omitempty"`
+	// Event is empty for newly published versions, otherwise it describes the
+	// change to the version, such as DeleteEvent, which happened at CreatedDate.
+	Event     string `json:"event,omitempty"`
+	SchemaVer string `json:"schema_ver"`
 }
 
 type PackagePollError struct {
@@ -54,6 +130,10 @@ func (err PackagePollError) Error() string {
 	return fmt.Sprintf("Polling for package %s returned error: %v", err.Name, err.Err)
 }
 
+func (err PackagePollError) Unwrap() error {
+	return err.Err
+}
+
 // NewPackage creates a Package object without the artifact ID field populated.
 func NewPackage(created time.Time, name, version, feed string) *Package {
 	return NewArtifact(created, name, version, "", feed)
@@ -71,6 +151,14 @@ func NewArtifact(created time.Time, name, version, artifactID, feed string) *Pac
 	}
 }
 
+// NewPackageEvent creates a Package object describing an event which happened to
+// an existing package version.
+func NewPackageEvent(created time.Time, name, version, event, feed string) *Package {
+	pkg := NewPackage(created, name, version, feed)
+	pkg.Event = event
+	return pkg
+}
+
 func ApplyCutoff(pkgs []*Package, cutoff time.Time) []*Package {
 	filteredPackages := []*Package{}
 	for _, pkg := range pkgs {
@@ -44,6 +44,19 @@ func TestValidSchema(t *testing.T) {
 	}
 }
 
+func TestValidSchemaPackageEvent(t *testing.T) {
+	t.Parallel()
+
+	pkg := NewPackageEvent(time.Now().UTC(), "foobarpackage", "1.0.0", DeleteEvent, "nuget")
+	result, err := gojsonschema.Validate(schemaLoader, gojsonschema.NewGoLoader(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid() {
+		t.Fatalf("Package event is not valid against the current schema: %v", result.Errors())
+	}
+}
+
 func TestInvalidSchema(t *testing.T) {
 	t.Parallel()
 
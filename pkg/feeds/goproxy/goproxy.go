@@ -2,12 +2,18 @@ package goproxy
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/useragent"
 	"github.com/ossf/package-feeds/pkg/utils"
@@ -16,6 +22,14 @@ import (
 const (
 	FeedName  = "goproxy"
 	indexPath = "/index"
+
+	// indexLimit is the maximum number of entries returned by a single request
+	// to the index.
+	indexLimit = 2000
+
+	// maxIndexPages bounds the number of pages of the index fetched by each call
+	// to Latest, the remaining entries are fetched by subsequent calls.
+	maxIndexPages = 10
 )
 
 var httpClient = &http.Client{
@@ -35,7 +49,7 @@ type Package struct {
 	Version      string
 }
 
-func fetchPackages(baseURL string, since time.Time) ([]Package, error) {
+func fetchPackages(ctx context.Context, baseURL string, since time.Time) ([]Package, error) {
 	var packages []Package
 	indexURL, err := url.JoinPath(baseURL, indexPath)
 	if err != nil {
@@ -46,10 +60,15 @@ func fetchPackages(baseURL string, since time.Time) ([]Package, error) {
 		return nil, err
 	}
 	params := url.Values{}
-	params.Add("since", since.Format(time.RFC3339))
+	params.Add("since", since.Format(time.RFC3339Nano))
+	params.Add("limit", strconv.Itoa(indexLimit))
 	pkgURL.RawQuery = params.Encode()
 
-	resp, err := httpClient.Get(pkgURL.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pkgURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -86,29 +105,124 @@ func fetchPackages(baseURL string, since time.Time) ([]Package, error) {
 	return packages, nil
 }
 
+// fetchIndex returns the index entries since the given time, paging through the
+// index while each page is full. If paging stops before the end of the index, a
+// lossy feed event is dispatched and the entries sharing the timestamp of the
+// last page are left to be fetched by the next call, as the page may not have
+// contained all of them.
+func (feed Feed) fetchIndex(ctx context.Context, since time.Time) ([]Package, error) {
+	packages := []Package{}
+	seen := map[string]bool{}
+	for page := 1; ; page++ {
+		result, err := fetchPackages(ctx, feed.baseURL, since)
+		if err != nil {
+			return packagesBefore(packages, since), err
+		}
+		// The index includes entries at the since timestamp, so the entries on the
+		// boundary of each page are returned again by the following page.
+		for _, pkg := range result {
+			key := pkg.Title + "@" + pkg.Version
+			if !seen[key] {
+				seen[key] = true
+				packages = append(packages, pkg)
+			}
+		}
+		if len(result) < indexLimit {
+			return packages, nil
+		}
+
+		last := result[len(result)-1].ModifiedDate
+		if result[0].ModifiedDate.Equal(last) {
+			// The entries of a single timestamp exceed the index limit, so the
+			// remainder of them cannot be fetched.
+			log.WithField("timestamp", last).Warn("Skipping goproxy index entries which exceed the index limit")
+			feed.dispatchLossyFeedEvent()
+			last = last.Add(time.Nanosecond)
+		}
+		since = last
+		if page == maxIndexPages {
+			// The remaining entries are fetched by the next call, but the feed is
+			// falling behind the index.
+			log.WithField("pages", page).Warn("Stopped paging goproxy index before reaching the end")
+			feed.dispatchLossyFeedEvent()
+			return packagesBefore(packages, since), nil
+		}
+	}
+}
+
+func (feed Feed) dispatchLossyFeedEvent() {
+	err := feed.eventHandler.DispatchEvent(events.LossyFeedEvent{Feed: feed.options.InstanceName(FeedName)})
+	if err != nil {
+		log.WithError(err).Error("failed to dispatch event via event handler")
+	}
+}
+
+// packagesBefore returns the packages modified before t.
+func packagesBefore(packages []Package, t time.Time) []Package {
+	filtered := []Package{}
+	for _, pkg := range packages {
+		if pkg.ModifiedDate.Before(t) {
+			filtered = append(filtered, pkg)
+		}
+	}
+	return filtered
+}
+
 type Feed struct {
-	baseURL string
-	options feeds.FeedOptions
+	baseURL      string
+	eventHandler *events.Handler
+	options      feeds.FeedOptions
+
+	// packages holds the module paths to poll from the module proxy at proxyURL,
+	// or is nil to poll all modules from the index.
+	packages  *[]string
+	proxyURL  string
+	infoCache *lru.Cache[string, time.Time]
 }
 
-func New(feedOptions feeds.FeedOptions) (*Feed, error) {
-	if feedOptions.Packages != nil {
+func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, error) {
+	if feedOptions.Packages == nil && feedOptions.URL != "" {
+		// The index is only served by index.golang.org, so a module proxy can only
+		// be configured when polling specific modules.
 		return nil, feeds.UnsupportedOptionError{
 			Feed:   FeedName,
-			Option: "packages",
+			Option: "url",
 		}
 	}
+	proxyURL := feedOptions.URL
+	if proxyURL == "" {
+		proxyURL = "https://proxy.golang.org/"
+	}
+	infoCache, err := lru.New[string, time.Time](infoCacheLimit)
+	if err != nil {
+		return nil, err
+	}
 	return &Feed{
-		baseURL: "https://index.golang.org/",
-		options: feedOptions,
+		baseURL:      "https://index.golang.org/",
+		eventHandler: eventHandler,
+		options:      feedOptions,
+		packages:     feedOptions.Packages,
+		proxyURL:     proxyURL,
+		infoCache:    infoCache,
 	}, nil
 }
 
-func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+func (feed Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	if feed.packages != nil {
+		pkgs, errs := feed.fetchCriticalPackages(ctx, *feed.packages)
+		if len(pkgs) == 0 && len(errs) != 0 {
+			// If none of the modules were successfully polled for, return early.
+			return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
+		}
+		newCutoff := feeds.FindCutoff(cutoff, pkgs)
+		return feeds.ApplyCutoff(pkgs, cutoff), newCutoff, errs
+	}
+
 	pkgs := []*feeds.Package{}
-	packages, err := fetchPackages(feed.baseURL, cutoff)
+	errs := []error{}
+	packages, err := feed.fetchIndex(ctx, cutoff)
 	if err != nil {
-		return pkgs, cutoff, []error{err}
+		errs = append(errs, err)
 	}
 	for _, pkg := range packages {
 		pkg := feeds.NewPackage(pkg.ModifiedDate, pkg.Title, pkg.Version, FeedName)
@@ -116,7 +230,13 @@ func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
 	}
 	newCutoff := feeds.FindCutoff(cutoff, pkgs)
 	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
-	return pkgs, newCutoff, []error{}
+	return pkgs, newCutoff, errs
+}
+
+// SupportsBackfill returns true, as the index can be paged from any point in time
+// and the module proxy lists every version of a module.
+func (feed Feed) SupportsBackfill() bool {
+	return true
 }
 
 func (feed Feed) GetName() string {
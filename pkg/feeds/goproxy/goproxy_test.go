@@ -1,11 +1,15 @@
 package goproxy
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/utils"
 	testutils "github.com/ossf/package-feeds/pkg/utils/test"
@@ -19,14 +23,14 @@ func TestGoProxyLatest(t *testing.T) {
 	}
 	srv := testutils.HTTPServerMock(handlers)
 
-	feed, err := New(feeds.FeedOptions{})
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
 	if err != nil {
 		t.Fatalf("Failed to create goproxy feed: %v", err)
 	}
 	feed.baseURL = srv.URL
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("feed.Latest returned error: %v", err)
 	}
@@ -64,14 +68,14 @@ func TestGoproxyNotFound(t *testing.T) {
 	}
 	srv := testutils.HTTPServerMock(handlers)
 
-	feed, err := New(feeds.FeedOptions{})
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
 	if err != nil {
 		t.Fatalf("Failed to create goproxy feed: %v", err)
 	}
 	feed.baseURL = srv.URL
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	_, gotCutoff, errs := feed.Latest(cutoff)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if cutoff != gotCutoff {
 		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
 	}
@@ -91,3 +95,247 @@ func goproxyPackageResponse(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
 	}
 }
+
+// indexMock serves the given entries, which must be sorted by timestamp, in the
+// same way as the index by returning at most indexLimit entries since the since
+// parameter.
+func indexMock(entries []PackageJSON) testutils.HTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n := 0
+		for _, e := range entries {
+			timestamp, _ := time.Parse(time.RFC3339Nano, e.Timestamp)
+			if timestamp.Before(since) {
+				continue
+			}
+			if n == indexLimit {
+				break
+			}
+			b, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "%s\n", b); err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+				return
+			}
+			n++
+		}
+	}
+}
+
+// indexEntries returns n entries starting after start, with count entries
+// sharing each timestamp.
+func indexEntries(start time.Time, n, count int) []PackageJSON {
+	entries := []PackageJSON{}
+	for i := 0; i < n; i++ {
+		entries = append(entries, PackageJSON{
+			Path:      fmt.Sprintf("example.com/mod%d", i),
+			Version:   "v1.0.0",
+			Timestamp: start.Add(time.Duration(i/count+1) * time.Millisecond).Format(time.RFC3339Nano),
+		})
+	}
+	return entries
+}
+
+func TestGoproxyLatestPagesIndex(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	entries := indexEntries(start, 2*indexLimit+500, 3)
+	srv := testutils.HTTPServerMock(map[string]testutils.HTTPHandlerFunc{
+		indexPath: indexMock(entries),
+	})
+
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create goproxy feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), start)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != len(entries) {
+		t.Errorf("feed.Latest returned %d packages, want %d", len(pkgs), len(entries))
+	}
+	wantCutoff, _ := time.Parse(time.RFC3339Nano, entries[len(entries)-1].Timestamp)
+	if !gotCutoff.Equal(wantCutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+}
+
+func TestGoproxyLatestMaxPages(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	entries := indexEntries(start, maxIndexPages*indexLimit+500, 3)
+	srv := testutils.HTTPServerMock(map[string]testutils.HTTPHandlerFunc{
+		indexPath: indexMock(entries),
+	})
+
+	sink := &events.MockSink{}
+	filter := events.NewFilter([]string{events.LossyFeedEventType}, nil, nil)
+	feed, err := New(feeds.FeedOptions{}, events.NewHandler(sink, *filter))
+	if err != nil {
+		t.Fatalf("Failed to create goproxy feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	// The entries beyond the page limit are returned by the following call, and
+	// only the call which hits the page limit dispatches a lossy feed event.
+	seen := map[string]bool{}
+	cutoff := start
+	for i := 0; i < 2; i++ {
+		pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+		if len(errs) != 0 {
+			t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+		}
+		if len(sink.GetEvents()) != 1 {
+			t.Errorf("feed.Latest dispatched %d events after %d calls, want 1", len(sink.GetEvents()), i+1)
+		}
+		for _, pkg := range pkgs {
+			if seen[pkg.Name] {
+				t.Errorf("feed.Latest returned %s more than once", pkg.Name)
+			}
+			seen[pkg.Name] = true
+		}
+		cutoff = gotCutoff
+	}
+	if len(seen) != len(entries) {
+		t.Errorf("feed.Latest returned %d packages, want %d", len(seen), len(entries))
+	}
+}
+
+func TestGoproxyLatestLossyPage(t *testing.T) {
+	t.Parallel()
+
+	// The first indexLimit+10 entries share the same timestamp, so 10 of them
+	// cannot be fetched.
+	start := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	entries := indexEntries(start, indexLimit+10, indexLimit+10)
+	entries = append(entries, PackageJSON{
+		Path:      "example.com/later",
+		Version:   "v1.0.0",
+		Timestamp: start.Add(time.Second).Format(time.RFC3339Nano),
+	})
+	srv := testutils.HTTPServerMock(map[string]testutils.HTTPHandlerFunc{
+		indexPath: indexMock(entries),
+	})
+
+	sink := &events.MockSink{}
+	filter := events.NewFilter([]string{events.LossyFeedEventType}, nil, nil)
+	feed, err := New(feeds.FeedOptions{Name: "goproxy-mirror"}, events.NewHandler(sink, *filter))
+	if err != nil {
+		t.Fatalf("Failed to create goproxy feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	pkgs, _, errs := feed.Latest(context.Background(), start)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if len(sink.GetEvents()) != 1 {
+		t.Errorf("feed.Latest dispatched %d events, want 1", len(sink.GetEvents()))
+	} else if e, ok := sink.GetEvents()[0].(events.LossyFeedEvent); !ok || e.Feed != "goproxy-mirror" {
+		t.Errorf("feed.Latest dispatched %v, want a lossy feed event for the goproxy-mirror feed", sink.GetEvents()[0])
+	}
+	if len(pkgs) != indexLimit+1 || pkgs[len(pkgs)-1].Name != "example.com/later" {
+		t.Errorf("feed.Latest returned %d packages, want %d ending with example.com/later", len(pkgs), indexLimit+1)
+	}
+}
+
+func newProxyFeed(t *testing.T, modules []string, handlers map[string]testutils.HTTPHandlerFunc) *Feed {
+	t.Helper()
+
+	srv := testutils.HTTPServerMock(handlers)
+	t.Cleanup(srv.Close)
+
+	feed, err := New(feeds.FeedOptions{Packages: &modules, URL: srv.URL}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create goproxy feed: %v", err)
+	}
+	return feed
+}
+
+func TestGoproxyLatestCriticalModules(t *testing.T) {
+	t.Parallel()
+
+	infoRequests := 0
+	feed := newProxyFeed(t, []string{"github.com/BurntSushi/toml"}, map[string]testutils.HTTPHandlerFunc{
+		// Upper case letters in module paths are escaped by the module proxy protocol.
+		"/github.com/!burnt!sushi/toml/@v/list": func(w http.ResponseWriter, _ *http.Request) {
+			if _, err := w.Write([]byte("v1.0.0\nv1.1.0\n")); err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+		"/github.com/!burnt!sushi/toml/@v/": func(w http.ResponseWriter, r *http.Request) {
+			infoRequests++
+			var body string
+			switch r.URL.Path {
+			case "/github.com/!burnt!sushi/toml/@v/v1.0.0.info":
+				body = `{"Version":"v1.0.0","Time":"2022-01-01T00:00:00Z"}`
+			case "/github.com/!burnt!sushi/toml/@v/v1.1.0.info":
+				body = `{"Version":"v1.1.0","Time":"2022-06-01T00:00:00Z"}`
+			default:
+				http.NotFound(w, r)
+				return
+			}
+			if _, err := w.Write([]byte(body)); err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+	})
+
+	cutoff := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "github.com/BurntSushi/toml" || pkgs[0].Version != "v1.1.0" {
+		t.Fatalf("feed.Latest returned %v, want github.com/BurntSushi/toml@v1.1.0", pkgs)
+	}
+	wantCutoff := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	if !gotCutoff.Equal(wantCutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+
+	// The info of each version is only fetched once.
+	if _, _, errs := feed.Latest(context.Background(), gotCutoff); len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if infoRequests != 2 {
+		t.Errorf("feed.Latest made %d info requests, want 2", infoRequests)
+	}
+}
+
+func TestGoproxyCriticalModuleNotFound(t *testing.T) {
+	t.Parallel()
+
+	feed := newProxyFeed(t, []string{"example.com/missing"}, map[string]testutils.HTTPHandlerFunc{
+		"/example.com/missing/@v/list": testutils.NotFoundHandlerFunc,
+	})
+
+	cutoff := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if !gotCutoff.Equal(cutoff) {
+		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
+	}
+	if len(errs) != 2 {
+		t.Fatalf("feed.Latest returned errors %v, want 2", errs)
+	}
+	if !errors.Is(errs[0], utils.ErrUnsuccessfulRequest) || !errors.Is(errs[1], feeds.ErrNoPackagesPolled) {
+		t.Errorf("feed.Latest returned errors %v, want an unsuccessful request and %v", errs, feeds.ErrNoPackagesPolled)
+	}
+}
+
+func TestGoproxyURLRequiresPackages(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(feeds.FeedOptions{URL: "https://goproxy.example.com"}, events.NewNullHandler())
+	if !errors.As(err, &feeds.UnsupportedOptionError{}) {
+		t.Errorf("New returned %v, want an unsupported option error", err)
+	}
+}
@@ -0,0 +1,156 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+const (
+	// infoCacheLimit defines how many version timestamps are remembered, so that
+	// the info of each version is only fetched once.
+	infoCacheLimit = 10000
+)
+
+type versionInfo struct {
+	Version string    `json:"Version"`
+	Time    time.Time `json:"Time"`
+}
+
+// fetchProxy makes a request to the module proxy for the given escaped module
+// path and returns the response.
+func fetchProxy(ctx context.Context, proxyURL, escapedPath string, elem ...string) (*http.Response, error) {
+	reqURL, err := url.JoinPath(proxyURL, append([]string{escapedPath, "@v"}, elem...)...)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckResponseStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch module proxy data: %w", err)
+	}
+	return resp, nil
+}
+
+// fetchVersionList returns the versions of a module listed by the module proxy.
+func fetchVersionList(ctx context.Context, proxyURL, escapedPath string) ([]string, error) {
+	resp, err := fetchProxy(ctx, proxyURL, escapedPath, "list")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	versions := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		// Each line may be followed by further fields, only the version is used.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			versions = append(versions, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// fetchVersionInfo returns the info of a version of a module from the module proxy.
+func fetchVersionInfo(ctx context.Context, proxyURL, escapedPath, version string) (*versionInfo, error) {
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fetchProxy(ctx, proxyURL, escapedPath, escapedVersion+".info")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	info := &versionInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// fetchModule returns every version of a module available from the module proxy.
+func (feed Feed) fetchModule(ctx context.Context, modulePath string) ([]Package, error) {
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := fetchVersionList(ctx, feed.proxyURL, escapedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := []Package{}
+	for _, version := range versions {
+		key := modulePath + "@" + version
+		created, ok := feed.infoCache.Get(key)
+		if !ok {
+			info, err := fetchVersionInfo(ctx, feed.proxyURL, escapedPath, version)
+			if err != nil {
+				return nil, err
+			}
+			created = info.Time
+			feed.infoCache.Add(key, created)
+		}
+		packages = append(packages, Package{
+			Title:        modulePath,
+			ModifiedDate: created,
+			Version:      version,
+		})
+	}
+	return packages, nil
+}
+
+// fetchCriticalPackages returns every version of each of the given modules,
+// fetching the modules concurrently.
+func (feed Feed) fetchCriticalPackages(ctx context.Context, modules []string) ([]*feeds.Package, []error) {
+	pkgs := []*feeds.Package{}
+	errs := []error{}
+	packageChannel := make(chan []Package)
+	errChannel := make(chan error)
+
+	for _, modulePath := range modules {
+		go func(modulePath string) {
+			packages, err := feed.fetchModule(ctx, modulePath)
+			if err != nil {
+				errChannel <- feeds.PackagePollError{Name: modulePath, Err: err}
+				return
+			}
+			packageChannel <- packages
+		}(modulePath)
+	}
+
+	for i := 0; i < len(modules); i++ {
+		select {
+		case packages := <-packageChannel:
+			for _, pkg := range packages {
+				pkgs = append(pkgs, feeds.NewPackage(pkg.ModifiedDate, pkg.Title, pkg.Version, FeedName))
+			}
+		case err := <-errChannel:
+			errs = append(errs, err)
+		}
+	}
+	return pkgs, errs
+}
@@ -2,25 +2,48 @@ package maven
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/useragent"
+	"github.com/ossf/package-feeds/pkg/utils"
 )
 
 const (
-	FeedName  = "maven-central"
-	indexPath = "/api/internal/browse/components"
+	FeedName   = "maven-central"
+	indexPath  = "/api/internal/browse/components"
+	searchPath = "/solrsearch/select"
+
+	// maxPages bounds the number of pages of components fetched by each call to
+	// Latest. As components are sorted by most recently published, components
+	// beyond the last page are missed.
+	maxPages = 50
+
+	// versionsLimit controls how many of the most recent versions of a component
+	// are requested from the search API.
+	versionsLimit = 50
+
+	// searchWorkers controls how many components have their versions resolved
+	// concurrently.
+	searchWorkers = 10
 )
 
 type Feed struct {
-	baseURL string
-	options feeds.FeedOptions
+	baseURL      string
+	searchURL    string
+	eventHandler *events.Handler
+	options      feeds.FeedOptions
 }
 
 var (
@@ -32,7 +55,7 @@ var (
 	ErrMaxRetriesReached = errors.New("maximum retries reached due to rate limiting")
 )
 
-func New(feedOptions feeds.FeedOptions) (*Feed, error) {
+func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, error) {
 	if feedOptions.Packages != nil {
 		return nil, feeds.UnsupportedOptionError{
 			Feed:   FeedName,
@@ -40,8 +63,10 @@ func New(feedOptions feeds.FeedOptions) (*Feed, error) {
 		}
 	}
 	return &Feed{
-		baseURL: "https://central.sonatype.com",
-		options: feedOptions,
+		baseURL:      "https://central.sonatype.com",
+		searchURL:    "https://search.maven.org",
+		eventHandler: eventHandler,
+		options:      feedOptions,
 	}, nil
 }
 
@@ -62,8 +87,22 @@ type Response struct {
 	Components []Package `json:"components"`
 }
 
+// Version represents a version of a component returned by the search API.
+type Version struct {
+	Version             string `json:"v"`
+	TimestampUnixWithMS int64  `json:"timestamp"`
+}
+
+// SearchResponse represents the response structure from the search API.
+type SearchResponse struct {
+	Response struct {
+		NumFound int       `json:"numFound"`
+		Docs     []Version `json:"docs"`
+	} `json:"response"`
+}
+
 // fetchPackages fetches packages from Sonatype API for the given page.
-func (feed Feed) fetchPackages(page int) ([]Package, error) {
+func (feed Feed) fetchPackages(ctx context.Context, page int) ([]Package, error) {
 	indexURL, err := url.JoinPath(feed.baseURL, indexPath)
 	if err != nil {
 		return nil, err
@@ -89,13 +128,21 @@ func (feed Feed) fetchPackages(page int) ([]Package, error) {
 		body := bytes.NewReader(jsonPayload)
 
 		// Send POST request to Sonatype API.
-		resp, err := httpClient.Post(indexURL, "application/json", body)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, indexURL, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpClient.Do(req)
 		if err != nil {
 			// Check if maximum retries have been reached
 			if attempt == maxRetries {
 				return nil, fmt.Errorf("error sending request: %w", err)
 			}
-			time.Sleep(retryDelay) // Wait before retrying
+			// Wait before retrying
+			if err := sleep(ctx, retryDelay); err != nil {
+				return nil, err
+			}
 			continue
 		}
 		defer resp.Body.Close()
@@ -106,7 +153,10 @@ func (feed Feed) fetchPackages(page int) ([]Package, error) {
 			if attempt == maxRetries {
 				return nil, ErrMaxRetriesReached
 			}
-			time.Sleep(retryDelay) // Wait before retrying
+			// Wait before retrying
+			if err := sleep(ctx, retryDelay); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
@@ -121,30 +171,146 @@ func (feed Feed) fetchPackages(page int) ([]Package, error) {
 	return nil, ErrMaxRetriesReached
 }
 
-func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+// sleep waits for the given duration, returning early with an error if the
+// context is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// fetchVersions fetches the most recent versions of a component from the search API.
+func (feed Feed) fetchVersions(ctx context.Context, pkg Package) (*SearchResponse, error) {
+	searchURL, err := url.JoinPath(feed.searchURL, searchPath)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Add("q", fmt.Sprintf("g:%q AND a:%q", pkg.Namespace, pkg.Name))
+	params.Add("core", "gav")
+	params.Add("rows", strconv.Itoa(versionsLimit))
+	params.Add("wt", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := utils.CheckResponseStatus(resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch maven versions: %w", err)
+	}
+
+	response := &SearchResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return response, nil
+}
+
+// componentVersions returns the versions of a component published after the
+// cutoff. If the versions cannot be resolved, only the latest version of the
+// component is returned along with the error.
+func (feed Feed) componentVersions(ctx context.Context, pkg Package, cutoff time.Time) ([]*feeds.Package, error) {
+	packageName := pkg.Namespace + ":" + pkg.Name
+	response, err := feed.fetchVersions(ctx, pkg)
+	if err != nil {
+		timestamp := time.UnixMilli(pkg.LatestVersionInfo.TimestampUnixWithMS)
+		latest := feeds.NewPackage(timestamp, packageName, pkg.LatestVersionInfo.Version, FeedName)
+		return []*feeds.Package{latest}, feeds.PackagePollError{Name: packageName, Err: err}
+	}
+
+	pkgs := []*feeds.Package{}
+	hasLatest := false
+	for _, v := range response.Response.Docs {
+		timestamp := time.UnixMilli(v.TimestampUnixWithMS)
+		if timestamp.After(cutoff) {
+			pkgs = append(pkgs, feeds.NewPackage(timestamp, packageName, v.Version, FeedName))
+		}
+		hasLatest = hasLatest || v.Version == pkg.LatestVersionInfo.Version
+	}
+	if len(pkgs) == len(response.Response.Docs) && response.Response.NumFound > len(pkgs) {
+		// Every version returned was published after the cutoff, so older versions
+		// which were also published after the cutoff may be missing.
+		log.WithField("package", packageName).Warn("Maven component has more new versions than can be fetched")
+		feed.dispatchLossyFeedEvent()
+	}
+
+	// The search index lags behind the components index, so the latest version
+	// may not be searchable yet. It is returned regardless, as the cutoff moves
+	// past it.
+	latestTimestamp := time.UnixMilli(pkg.LatestVersionInfo.TimestampUnixWithMS)
+	if !hasLatest && latestTimestamp.After(cutoff) {
+		pkgs = append(pkgs, feeds.NewPackage(latestTimestamp, packageName, pkg.LatestVersionInfo.Version, FeedName))
+	}
+	return pkgs, nil
+}
+
+// resolveVersions returns the versions of each component published after the
+// cutoff, resolving the versions of several components concurrently.
+func (feed Feed) resolveVersions(
+	ctx context.Context, packages []Package, cutoff time.Time,
+) ([]*feeds.Package, []error) {
+	results := make([][]*feeds.Package, len(packages))
+	resultErrs := make([]error, len(packages))
+	sem := make(chan struct{}, searchWorkers)
+	var wg sync.WaitGroup
+	for i, pkg := range packages {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], resultErrs[i] = feed.componentVersions(ctx, pkg, cutoff)
+		}()
+	}
+	wg.Wait()
+
 	pkgs := []*feeds.Package{}
+	errs := []error{}
+	for i := range packages {
+		pkgs = append(pkgs, results[i]...)
+		if resultErrs[i] != nil {
+			errs = append(errs, resultErrs[i])
+		}
+	}
+	return pkgs, errs
+}
+
+func (feed Feed) dispatchLossyFeedEvent() {
+	err := feed.eventHandler.DispatchEvent(events.LossyFeedEvent{Feed: feed.options.InstanceName(FeedName)})
+	if err != nil {
+		log.WithError(err).Error("failed to dispatch event via event handler")
+	}
+}
+
+func (feed Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	var changed []Package
 	var errs []error
 
 	page := 0
 	for {
 		// Fetch packages from Sonatype API for the current page.
-		packages, err := feed.fetchPackages(page)
+		packages, err := feed.fetchPackages(ctx, page)
 		if err != nil {
 			errs = append(errs, err)
 			break
 		}
 
-		// Iterate over packages
+		// Collect the components with a version published after the cutoff.
 		hasToCut := false
 		for _, pkg := range packages {
-			// convert published to date to compare with cutoff
 			if pkg.LatestVersionInfo.TimestampUnixWithMS > cutoff.UnixMilli() {
-				// Append package to pkgs
-				timestamp := time.Unix(pkg.LatestVersionInfo.TimestampUnixWithMS/1000, 0)
-				packageName := pkg.Namespace + ":" + pkg.Name
-
-				newPkg := feeds.NewPackage(timestamp, packageName, pkg.LatestVersionInfo.Version, FeedName)
-				pkgs = append(pkgs, newPkg)
+				changed = append(changed, pkg)
 			} else {
 				// Break the loop if the cutoff date is reached
 				hasToCut = true
@@ -155,11 +321,19 @@ func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
 		page++
 
 		// Check if the loop should be terminated
-		if len(pkgs) == 0 || hasToCut {
+		if len(changed) == 0 || hasToCut {
+			break
+		}
+		if page == maxPages {
+			log.WithField("pages", page).Warn("Stopped paging Maven components before reaching the cutoff")
+			feed.dispatchLossyFeedEvent()
 			break
 		}
 	}
 
+	pkgs, versionErrs := feed.resolveVersions(ctx, changed, cutoff)
+	errs = append(errs, versionErrs...)
+
 	newCutoff := feeds.FindCutoff(cutoff, pkgs)
 	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
 
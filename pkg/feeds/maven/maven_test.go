@@ -1,10 +1,13 @@
 package maven
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	testutils "github.com/ossf/package-feeds/pkg/utils/test"
 )
@@ -13,18 +16,20 @@ func TestMavenLatest(t *testing.T) {
 	t.Parallel()
 
 	handlers := map[string]testutils.HTTPHandlerFunc{
-		indexPath: mavenPackageResponse,
+		indexPath:  mavenPackageResponse,
+		searchPath: mavenSearchResponse,
 	}
 	srv := testutils.HTTPServerMock(handlers)
 
-	feed, err := New(feeds.FeedOptions{})
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
 	if err != nil {
 		t.Fatalf("Failed to create Maven feed: %v", err)
 	}
 	feed.baseURL = srv.URL
+	feed.searchURL = srv.URL
 
 	cutoff := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 
 	if len(errs) != 0 {
 		t.Fatalf("feed.Latest returned error: %v", errs)
@@ -57,7 +62,7 @@ func TestMavenNotFound(t *testing.T) {
 	}
 	srv := testutils.HTTPServerMock(handlers)
 
-	feed, err := New(feeds.FeedOptions{})
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
 	if err != nil {
 		t.Fatalf("Failed to create Maven feed: %v", err)
 	}
@@ -65,7 +70,7 @@ func TestMavenNotFound(t *testing.T) {
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
 
-	_, gotCutoff, errs := feed.Latest(cutoff)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if cutoff != gotCutoff {
 		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
 	}
@@ -111,3 +116,163 @@ func mavenPackageResponse(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
 	}
 }
+
+func mavenSearchResponse(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	responseJSON := `
+	{
+		"response": {
+			"numFound": 3,
+			"docs": [
+				{"id": "com.github.example:project:1.0.0", "v": "1.0.0", "timestamp": 946684800000},
+				{"id": "com.github.example:project:0.9.1", "v": "0.9.1", "timestamp": 946684700123},
+				{"id": "com.github.example:project:0.9.0", "v": "0.9.0", "timestamp": 631152000000}
+			]
+		}
+	}
+	`
+	_, err := w.Write([]byte(responseJSON))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
+func TestMavenLatestAllVersions(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath:  mavenPackageResponse,
+		searchPath: mavenSearchResponse,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create Maven feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+	feed.searchURL = srv.URL
+
+	// Only version 0.9.0 was published before the cutoff.
+	cutoff := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("feed.Latest returned %d packages, want 2", len(pkgs))
+	}
+	if pkgs[1].Version != "0.9.1" {
+		t.Errorf("Unexpected version `%s` found in place of expected `0.9.1`", pkgs[1].Version)
+	}
+	// Timestamps keep their milliseconds.
+	if want := time.UnixMilli(946684700123); !pkgs[1].CreatedDate.Equal(want) {
+		t.Errorf("Package created at %v, want %v", pkgs[1].CreatedDate, want)
+	}
+}
+
+func TestMavenLatestSearchError(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath:  mavenPackageResponse,
+		searchPath: testutils.NotFoundHandlerFunc,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create Maven feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+	feed.searchURL = srv.URL
+
+	// The latest version is still returned if the versions cannot be resolved.
+	cutoff := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 1 {
+		t.Fatalf("feed.Latest returned errors %v, want 1", errs)
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "1.0.0" {
+		t.Errorf("feed.Latest returned %v, want version 1.0.0", pkgs)
+	}
+}
+
+func TestMavenLatestSearchLagging(t *testing.T) {
+	t.Parallel()
+
+	// The latest version 1.1.0 is not yet in the search index.
+	latest := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath: func(w http.ResponseWriter, _ *http.Request) {
+			_, err := fmt.Fprintf(w, `{"components": [{"namespace": "com.github.example", "name": "project",
+				"latestVersionInfo": {"version": "1.1.0", "timestampUnixWithMS": %d}},
+				{"namespace": "com.github.example", "name": "old",
+				"latestVersionInfo": {"version": "1.0.0", "timestampUnixWithMS": 0}}]}`, latest.UnixMilli())
+			if err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+		searchPath: mavenSearchResponse,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create Maven feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+	feed.searchURL = srv.URL
+
+	cutoff := time.Date(1999, 12, 31, 23, 59, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("feed.Latest returned %d packages, want 2", len(pkgs))
+	}
+	if pkgs[0].Version != "1.0.0" || pkgs[1].Version != "1.1.0" {
+		t.Errorf("feed.Latest returned versions %s and %s, want 1.0.0 and 1.1.0", pkgs[0].Version, pkgs[1].Version)
+	}
+	if !pkgs[1].CreatedDate.Equal(latest) {
+		t.Errorf("Package created at %v, want %v", pkgs[1].CreatedDate, latest)
+	}
+	if !gotCutoff.Equal(latest) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, latest)
+	}
+}
+
+func TestMavenLatestMaxPages(t *testing.T) {
+	t.Parallel()
+
+	// Every page contains components published after the cutoff.
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath: func(w http.ResponseWriter, _ *http.Request) {
+			_, err := fmt.Fprintf(w, `{"components": [{"namespace": "com.example", "name": "project",
+				"latestVersionInfo": {"version": "1.0.0", "timestampUnixWithMS": %d}}]}`, time.Now().UnixMilli())
+			if err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+		searchPath: mavenSearchResponse,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	sink := &events.MockSink{}
+	filter := events.NewFilter([]string{events.LossyFeedEventType}, nil, nil)
+	feed, err := New(feeds.FeedOptions{}, events.NewHandler(sink, *filter))
+	if err != nil {
+		t.Fatalf("Failed to create Maven feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+	feed.searchURL = srv.URL
+
+	cutoff := time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, _, errs := feed.Latest(context.Background(), cutoff); len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(sink.GetEvents()) != 1 {
+		t.Errorf("feed.Latest dispatched %d events, want 1", len(sink.GetEvents()))
+	}
+}
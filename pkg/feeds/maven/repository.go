@@ -0,0 +1,276 @@
+package maven
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+const (
+	RepositoryFeedName = "maven-repository"
+	metadataFile       = "maven-metadata.xml"
+
+	// lastUpdatedLayout is the format of the lastUpdated field of maven-metadata.xml.
+	lastUpdatedLayout = "20060102150405"
+)
+
+var (
+	errPackagesRequired  = errors.New("the packages option is required")
+	errInvalidCoordinate = errors.New("invalid maven coordinate, expected groupId:artifactId")
+)
+
+// Metadata represents the artifact level maven-metadata.xml of a Maven 2 layout
+// repository.
+type Metadata struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Versioning struct {
+		Versions    []string `xml:"versions>version"`
+		LastUpdated string   `xml:"lastUpdated"`
+	} `xml:"versioning"`
+}
+
+type coordinate struct {
+	groupID    string
+	artifactID string
+}
+
+func (c coordinate) String() string {
+	return c.groupID + ":" + c.artifactID
+}
+
+func parseCoordinate(s string) (coordinate, error) {
+	groupID, artifactID, ok := strings.Cut(s, ":")
+	if !ok || groupID == "" || artifactID == "" || strings.Contains(artifactID, ":") {
+		return coordinate{}, fmt.Errorf("%w : %v", errInvalidCoordinate, s)
+	}
+	return coordinate{groupID: groupID, artifactID: artifactID}, nil
+}
+
+// RepositoryFeed polls a list of artifacts from any Maven 2 layout repository,
+// such as Maven Central or a Nexus or Artifactory instance, by comparing the
+// versions listed in the maven-metadata.xml of each artifact between polls.
+type RepositoryFeed struct {
+	baseURL   string
+	artifacts []coordinate
+	options   feeds.FeedOptions
+
+	// mu guards known, which holds the versions of each artifact seen by previous
+	// polls.
+	mu    sync.Mutex
+	known map[coordinate]map[string]bool
+}
+
+func NewRepositoryFeed(feedOptions feeds.FeedOptions) (*RepositoryFeed, error) {
+	if feedOptions.Packages == nil {
+		return nil, fmt.Errorf("%w : %v", errPackagesRequired, RepositoryFeedName)
+	}
+	artifacts := []coordinate{}
+	for _, pkg := range *feedOptions.Packages {
+		c, err := parseCoordinate(pkg)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, c)
+	}
+	baseURL := feedOptions.URL
+	if baseURL == "" {
+		baseURL = "https://repo1.maven.org/maven2/"
+	}
+	return &RepositoryFeed{
+		baseURL:   baseURL,
+		artifacts: artifacts,
+		options:   feedOptions,
+		known:     map[coordinate]map[string]bool{},
+	}, nil
+}
+
+// fetchMetadata fetches the maven-metadata.xml of an artifact, returning the
+// metadata along with the time it was last updated.
+func (feed *RepositoryFeed) fetchMetadata(ctx context.Context, c coordinate) (*Metadata, time.Time, error) {
+	metadataURL, err := url.JoinPath(feed.baseURL, strings.ReplaceAll(c.groupID, ".", "/"), c.artifactID, metadataFile)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if err := utils.CheckResponseStatus(resp); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to fetch maven metadata: %w", err)
+	}
+
+	metadata := &Metadata{}
+	if err := xml.NewDecoder(resp.Body).Decode(metadata); err != nil {
+		return nil, time.Time{}, fmt.Errorf("error decoding maven metadata: %w", err)
+	}
+
+	// Fall back to the Last-Modified header, then the current time, for
+	// repositories which do not record when the metadata was last updated.
+	updated, err := time.Parse(lastUpdatedLayout, metadata.Versioning.LastUpdated)
+	if err != nil {
+		updated, err = http.ParseTime(resp.Header.Get("Last-Modified"))
+		if err != nil {
+			updated = time.Now().UTC()
+		}
+	}
+	return metadata, updated, nil
+}
+
+// fetchPublished returns the time a version of an artifact was published, from
+// the Last-Modified header of its POM. False is returned if the time is unknown.
+func (feed *RepositoryFeed) fetchPublished(ctx context.Context, c coordinate, version string) (time.Time, bool) {
+	pomURL, err := url.JoinPath(feed.baseURL, strings.ReplaceAll(c.groupID, ".", "/"), c.artifactID, version,
+		c.artifactID+"-"+version+".pom")
+	if err != nil {
+		return time.Time{}, false
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, pomURL, nil)
+	if err != nil {
+		return time.Time{}, false
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, false
+	}
+	resp.Body.Close()
+	if utils.CheckResponseStatus(resp) != nil {
+		return time.Time{}, false
+	}
+	published, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return published, true
+}
+
+// newVersions returns the versions of an artifact which were not listed by the
+// previous poll, recording the listed versions for the next poll. False is
+// returned if the artifact was not polled before, along with every version.
+func (feed *RepositoryFeed) newVersions(c coordinate, versions []string) ([]string, bool) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	known, ok := feed.known[c]
+	feed.known[c] = map[string]bool{}
+	for _, v := range versions {
+		feed.known[c][v] = true
+	}
+	if !ok {
+		return versions, false
+	}
+
+	added := []string{}
+	for _, v := range versions {
+		if !known[v] {
+			added = append(added, v)
+		}
+	}
+	return added, true
+}
+
+// pollArtifact returns the versions of an artifact added since the previous poll,
+// created at the time each version was published, or otherwise at the time the
+// metadata was last updated.
+//
+// The first time an artifact is polled, such as after a restart, the versions
+// published after the cutoff are returned if the metadata was updated after the
+// cutoff. Versions are listed in the order they were added, so they are checked
+// from the most recent until one published before the cutoff. If the time a
+// version was published is unknown, only the most recent version is returned.
+func (feed *RepositoryFeed) pollArtifact(
+	ctx context.Context, c coordinate, cutoff time.Time,
+) ([]*feeds.Package, error) {
+	metadata, updated, err := feed.fetchMetadata(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	versions, seen := feed.newVersions(c, metadata.Versioning.Versions)
+
+	pkgs := []*feeds.Package{}
+	if seen {
+		for _, v := range versions {
+			created, ok := feed.fetchPublished(ctx, c, v)
+			if !ok {
+				created = updated
+			}
+			pkgs = append(pkgs, feeds.NewPackage(created, c.String(), v, RepositoryFeedName))
+		}
+		return pkgs, nil
+	}
+
+	if !updated.After(cutoff) {
+		return pkgs, nil
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		created, ok := feed.fetchPublished(ctx, c, versions[i])
+		if !ok {
+			if len(pkgs) == 0 {
+				pkgs = append(pkgs, feeds.NewPackage(updated, c.String(), versions[i], RepositoryFeedName))
+			}
+			break
+		}
+		if !created.After(cutoff) {
+			break
+		}
+		pkgs = append([]*feeds.Package{feeds.NewPackage(created, c.String(), versions[i], RepositoryFeedName)}, pkgs...)
+	}
+	return pkgs, nil
+}
+
+// Latest returns the versions of each artifact added since the previous poll.
+func (feed *RepositoryFeed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	pkgs := []*feeds.Package{}
+	errs := []error{}
+	packageChannel := make(chan []*feeds.Package)
+	errChannel := make(chan error)
+
+	for _, c := range feed.artifacts {
+		go func(c coordinate) {
+			artifactPkgs, err := feed.pollArtifact(ctx, c, cutoff)
+			if err != nil {
+				errChannel <- feeds.PackagePollError{Name: c.String(), Err: err}
+				return
+			}
+			packageChannel <- artifactPkgs
+		}(c)
+	}
+
+	for i := 0; i < len(feed.artifacts); i++ {
+		select {
+		case artifactPkgs := <-packageChannel:
+			pkgs = append(pkgs, artifactPkgs...)
+		case err := <-errChannel:
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == len(feed.artifacts) && len(errs) != 0 {
+		// If none of the artifacts were successfully polled for, return early.
+		return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
+	}
+	return pkgs, feeds.FindCutoff(cutoff, pkgs), errs
+}
+
+func (feed *RepositoryFeed) GetName() string {
+	return RepositoryFeedName
+}
+
+func (feed *RepositoryFeed) GetFeedOptions() feeds.FeedOptions {
+	return feed.options
+}
@@ -0,0 +1,182 @@
+package maven
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+	testutils "github.com/ossf/package-feeds/pkg/utils/test"
+)
+
+const metadataPath = "/com/example/project/maven-metadata.xml"
+
+// metadataResponse serves the metadata of com.example:project listing the given
+// versions.
+func metadataResponse(versions *[]string, lastUpdated string) testutils.HTTPHandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		body := "<metadata><groupId>com.example</groupId><artifactId>project</artifactId><versioning><versions>"
+		for _, v := range *versions {
+			body += fmt.Sprintf("<version>%s</version>", v)
+		}
+		body += fmt.Sprintf("</versions><lastUpdated>%s</lastUpdated></versioning></metadata>", lastUpdated)
+		if _, err := w.Write([]byte(body)); err != nil {
+			http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+		}
+	}
+}
+
+func newTestRepositoryFeed(
+	t *testing.T, packages []string, handlers map[string]testutils.HTTPHandlerFunc,
+) *RepositoryFeed {
+	t.Helper()
+
+	srv := testutils.HTTPServerMock(handlers)
+	t.Cleanup(srv.Close)
+
+	feed, err := NewRepositoryFeed(feeds.FeedOptions{Packages: &packages, URL: srv.URL})
+	if err != nil {
+		t.Fatalf("Failed to create Maven repository feed: %v", err)
+	}
+	return feed
+}
+
+func TestRepositoryLatest(t *testing.T) {
+	t.Parallel()
+
+	versions := []string{"1.0.0", "1.1.0"}
+	feed := newTestRepositoryFeed(t, []string{"com.example:project"}, map[string]testutils.HTTPHandlerFunc{
+		metadataPath: metadataResponse(&versions, "20240301120000"),
+	})
+
+	// The first poll only returns the most recent version.
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "com.example:project" || pkgs[0].Version != "1.1.0" {
+		t.Fatalf("feed.Latest returned %v, want com.example:project 1.1.0", pkgs)
+	}
+	wantCutoff := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if !gotCutoff.Equal(wantCutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+
+	// Subsequent polls return each version added since the previous poll.
+	versions = append(versions, "1.2.0", "2.0.0")
+	pkgs, _, errs = feed.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 2 || pkgs[0].Version != "1.2.0" || pkgs[1].Version != "2.0.0" {
+		t.Errorf("feed.Latest returned %v, want versions 1.2.0 and 2.0.0", pkgs)
+	}
+	for _, p := range pkgs {
+		if p.Type != RepositoryFeedName {
+			t.Errorf("Feed type not set correctly in maven package following Latest()")
+		}
+	}
+}
+
+// pomResponse serves the POM of a version of com.example:project, last modified
+// at the given time.
+func pomResponse(lastModified time.Time) testutils.HTTPHandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+}
+
+func TestRepositoryLatestPublished(t *testing.T) {
+	t.Parallel()
+
+	versions := []string{"1.0.0", "1.1.0", "1.2.0"}
+	published := []time.Time{
+		time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		metadataPath: metadataResponse(&versions, "20240301120000"),
+	}
+	for i, v := range versions {
+		handlers[fmt.Sprintf("/com/example/project/%s/project-%s.pom", v, v)] = pomResponse(published[i])
+	}
+	feed := newTestRepositoryFeed(t, []string{"com.example:project"}, handlers)
+
+	// The first poll, such as after a restart, returns every version published
+	// since the cutoff, created at the time each was published.
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 2 || pkgs[0].Version != "1.1.0" || pkgs[1].Version != "1.2.0" {
+		t.Fatalf("feed.Latest returned %v, want versions 1.1.0 and 1.2.0", pkgs)
+	}
+	for i, p := range pkgs {
+		if !p.CreatedDate.Equal(published[i+1]) {
+			t.Errorf("Version %s created at %v, want %v", p.Version, p.CreatedDate, published[i+1])
+		}
+	}
+	if !gotCutoff.Equal(published[2]) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, published[2])
+	}
+}
+
+func TestRepositoryLatestNotUpdated(t *testing.T) {
+	t.Parallel()
+
+	versions := []string{"1.0.0"}
+	feed := newTestRepositoryFeed(t, []string{"com.example:project"}, map[string]testutils.HTTPHandlerFunc{
+		metadataPath: metadataResponse(&versions, "20231201120000"),
+	})
+
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs)
+	}
+	if len(pkgs) != 0 {
+		t.Errorf("feed.Latest returned %v for metadata updated before the cutoff", pkgs)
+	}
+	if !gotCutoff.Equal(cutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, cutoff)
+	}
+}
+
+func TestRepositoryNotFound(t *testing.T) {
+	t.Parallel()
+
+	feed := newTestRepositoryFeed(t, []string{"com.example:project"}, map[string]testutils.HTTPHandlerFunc{
+		metadataPath: testutils.NotFoundHandlerFunc,
+	})
+
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if cutoff != gotCutoff {
+		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
+	}
+	if len(errs) != 2 {
+		t.Fatalf("feed.Latest returned errors %v, want 2", errs)
+	}
+	if !errors.Is(errs[0], utils.ErrUnsuccessfulRequest) || !errors.Is(errs[1], feeds.ErrNoPackagesPolled) {
+		t.Errorf("feed.Latest returned errors %v, want an unsuccessful request and %v", errs, feeds.ErrNoPackagesPolled)
+	}
+}
+
+func TestNewRepositoryFeedOptions(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewRepositoryFeed(feeds.FeedOptions{}); !errors.Is(err, errPackagesRequired) {
+		t.Errorf("NewRepositoryFeed returned %v without packages, want %v", err, errPackagesRequired)
+	}
+	packages := []string{"com.example"}
+	if _, err := NewRepositoryFeed(feeds.FeedOptions{Packages: &packages}); !errors.Is(err, errInvalidCoordinate) {
+		t.Errorf("NewRepositoryFeed returned %v for an invalid coordinate, want %v", err, errInvalidCoordinate)
+	}
+}
@@ -0,0 +1,275 @@
+package npm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+const (
+	ChangesFeedName = "npm-changes"
+	changesPath     = "/_changes"
+
+	// changesLimit controls how many changes are requested at a time.
+	changesLimit = 200
+
+	// maxChangesPages bounds the number of pages of changes fetched by each call
+	// to Latest, the remaining changes are fetched by subsequent calls.
+	maxChangesPages = 10
+
+	// changesOverlap allows for versions which are created shortly before the
+	// newest version of a previous poll, but appear later in the changes stream.
+	changesOverlap = 5 * time.Minute
+
+	// emittedLimit defines how many recently returned versions are remembered,
+	// to avoid returning versions again due to changesOverlap.
+	emittedLimit = 10000
+
+	// maxFetchAttempts bounds the number of polls which hold the cursor for a
+	// package failing with a retryable error, after which the package is skipped
+	// so that it cannot block the feed.
+	maxFetchAttempts = 5
+)
+
+var errFetchAttempts = errors.New("skipped package after repeated failures")
+
+type changesResponse struct {
+	Results []change        `json:"results"`
+	LastSeq json.RawMessage `json:"last_seq"`
+}
+
+type change struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+// ChangesFeed follows the CouchDB replication stream of the npm registry,
+// returning every version of each changed package created since the cutoff.
+// The sequence number of the stream is the cursor of the feed.
+type ChangesFeed struct {
+	registry   Feed
+	changesURL string
+	options    feeds.FeedOptions
+
+	// mu guards cursor, which is read when checkpointing outside of polling.
+	mu     sync.Mutex
+	cursor string
+
+	// emitted records recently returned versions, keyed by name and version.
+	emitted *lru.Cache[string, struct{}]
+
+	// attempts counts the consecutive polls in which each package failed with a
+	// retryable error, it is only accessed by Latest.
+	attempts map[string]int
+}
+
+func NewChangesFeed(feedOptions feeds.FeedOptions) (*ChangesFeed, error) {
+	if feedOptions.Packages != nil {
+		return nil, feeds.UnsupportedOptionError{
+			Feed:   ChangesFeedName,
+			Option: "packages",
+		}
+	}
+	registry, err := New(feeds.FeedOptions{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	emitted, err := lru.New[string, struct{}](emittedLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangesFeed{
+		registry:   *registry,
+		changesURL: "https://replicate.npmjs.com/",
+		options:    feedOptions,
+		emitted:    emitted,
+		attempts:   map[string]int{},
+	}, nil
+}
+
+// fetchChanges returns a page of changes since the given sequence number, since
+// may also be "now" to return no changes along with the current sequence number.
+func fetchChanges(ctx context.Context, feed *ChangesFeed, since string, limit int) (*changesResponse, error) {
+	changesURL, err := url.Parse(feed.changesURL)
+	if err != nil {
+		return nil, err
+	}
+	changesURL = changesURL.JoinPath(changesPath)
+	q := changesURL.Query()
+	q.Set("since", since)
+	q.Set("limit", strconv.Itoa(limit))
+	changesURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, changesURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := feed.registry.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := utils.CheckResponseStatus(resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch npm changes: %w", err)
+	}
+
+	changes := &changesResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(changes); err != nil {
+		return nil, fmt.Errorf("%w : %w for changes", errJSON, err)
+	}
+	return changes, nil
+}
+
+// seqString returns the sequence number as a string for use in the since
+// parameter, the sequence number is an integer or an opaque string depending on
+// the version of CouchDB.
+func seqString(seq json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(seq, &s); err == nil {
+		return s
+	}
+	return string(seq)
+}
+
+// isRetryable returns true if fetching a package failed for a reason which may
+// succeed if the package is fetched again.
+func isRetryable(err error) bool {
+	var reqErr utils.UnsuccessfulRequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode == http.StatusTooManyRequests || reqErr.StatusCode >= http.StatusInternalServerError
+	}
+	var parseErr *time.ParseError
+	return !errors.Is(err, errJSON) && !errors.As(err, &parseErr)
+}
+
+// Latest returns the versions created since the cutoff of each package changed
+// since the cursor along with the lifecycle events of those packages, advancing
+// the cursor past the changes which were processed. The cursor is not advanced
+// past changes for packages which failed to be fetched with a retryable error,
+// so that they are fetched again by the next call, unless the package has failed
+// in maxFetchAttempts consecutive calls, in which case it is skipped. The cutoff
+// is only advanced once the stream has been drained, as the remaining changes may
+// include versions created before those already returned.
+func (feed *ChangesFeed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	pkgs := []*feeds.Package{}
+	lifecycle := []*feeds.Package{}
+	var errs []error
+
+	cursor := feed.Cursor()
+	if cursor == "" {
+		// Without a cursor, follow the changes from the current sequence number.
+		changes, err := fetchChanges(ctx, feed, "now", 1)
+		if err != nil {
+			return nil, cutoff, append(errs, err)
+		}
+		cursor = seqString(changes.LastSeq)
+		feed.SetCursor(cursor)
+	}
+
+	drained := false
+	for page := 0; page < maxChangesPages; page++ {
+		changes, err := fetchChanges(ctx, feed, cursor, changesLimit)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		// A count of zero fetches all versions of each package.
+		uniquePackages := make(map[string]int)
+		for _, c := range changes.Results {
+			if c.Deleted || strings.HasPrefix(c.ID, "_design/") {
+				continue
+			}
+			uniquePackages[c.ID] = 0
+		}
+		npmPkgs, pageLifecycle, fetchErrs := fetchPackages(ctx, feed.registry, uniquePackages, cutoff)
+		pkgs = append(pkgs, feed.newVersions(npmPkgs, cutoff)...)
+		lifecycle = append(lifecycle, pageLifecycle...)
+
+		retry := false
+		for _, err := range fetchErrs {
+			errs = append(errs, err)
+			if !isRetryable(err) {
+				continue
+			}
+			var pollErr feeds.PackagePollError
+			if errors.As(err, &pollErr) {
+				feed.attempts[pollErr.Name]++
+				if feed.attempts[pollErr.Name] >= maxFetchAttempts {
+					errs = append(errs, feeds.PackagePollError{Name: pollErr.Name, Err: errFetchAttempts})
+					continue
+				}
+			}
+			retry = true
+		}
+		if retry {
+			break
+		}
+		for pkgTitle := range uniquePackages {
+			delete(feed.attempts, pkgTitle)
+		}
+		cursor = seqString(changes.LastSeq)
+		feed.SetCursor(cursor)
+		if len(changes.Results) < changesLimit {
+			drained = true
+			break
+		}
+	}
+
+	if !drained {
+		return append(pkgs, lifecycle...), cutoff, errs
+	}
+	// Only published versions move the cutoff, as for the registry feed.
+	return append(pkgs, lifecycle...), feeds.FindCutoff(cutoff, pkgs), errs
+}
+
+// newVersions returns the versions created within changesOverlap of the cutoff,
+// or later, which have not been returned recently.
+func (feed *ChangesFeed) newVersions(npmPkgs []*Package, cutoff time.Time) []*feeds.Package {
+	pkgs := []*feeds.Package{}
+	since := cutoff.Add(-changesOverlap)
+	for _, pkg := range npmPkgs {
+		if !pkg.CreatedDate.After(since) {
+			continue
+		}
+		key := pkg.Title + "@" + pkg.Version
+		if ok, _ := feed.emitted.ContainsOrAdd(key, struct{}{}); ok {
+			continue
+		}
+		pkgs = append(pkgs, newPackage(pkg))
+	}
+	return pkgs
+}
+
+func (feed *ChangesFeed) Cursor() string {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	return feed.cursor
+}
+
+func (feed *ChangesFeed) SetCursor(cursor string) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.cursor = cursor
+}
+
+func (feed *ChangesFeed) GetName() string {
+	return ChangesFeedName
+}
+
+func (feed *ChangesFeed) GetFeedOptions() feeds.FeedOptions {
+	return feed.options
+}
@@ -0,0 +1,254 @@
+package npm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+	testutils "github.com/ossf/package-feeds/pkg/utils/test"
+)
+
+// changesMock serves a changes stream with FooPackage changed at sequence 11,
+// a deleted package at sequence 12 and BarPackage changed at sequence 13.
+func changesMock(w http.ResponseWriter, r *http.Request) {
+	var body string
+	switch r.URL.Query().Get("since") {
+	case "now":
+		body = `{"results":[],"last_seq":10}`
+	case "10":
+		body = `{"results":[
+			{"seq":11,"id":"FooPackage","changes":[{"rev":"1-a"}]},
+			{"seq":12,"id":"DeletedPackage","changes":[{"rev":"2-b"}],"deleted":true},
+			{"seq":13,"id":"BarPackage","changes":[{"rev":"1-c"}]}
+		],"last_seq":13}`
+	default:
+		body = fmt.Sprintf(`{"results":[],"last_seq":%s}`, r.URL.Query().Get("since"))
+	}
+	if _, err := w.Write([]byte(body)); err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
+func newTestChangesFeed(t *testing.T, handlers map[string]testutils.HTTPHandlerFunc) *ChangesFeed {
+	t.Helper()
+
+	srv := testutils.HTTPServerMock(handlers)
+	t.Cleanup(srv.Close)
+
+	feed, err := NewChangesFeed(feeds.FeedOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create new npm changes feed: %v", err)
+	}
+	feed.changesURL = srv.URL
+	feed.registry.baseURL = srv.URL
+	return feed
+}
+
+func TestChangesLatest(t *testing.T) {
+	t.Parallel()
+
+	feed := newTestChangesFeed(t, map[string]testutils.HTTPHandlerFunc{
+		"/_changes":   changesMock,
+		"/FooPackage": fooVersionInfoResponse,
+		"/BarPackage": barVersionInfoResponse,
+	})
+
+	// Without a cursor the feed follows the changes from the current sequence.
+	cutoff := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if feed.Cursor() != "13" {
+		t.Errorf("feed.Cursor() = %q, want %q", feed.Cursor(), "13")
+	}
+	// Only FooPackage 1.0.1 and BarPackage 0.5.0-alpha are created after the cutoff.
+	if len(pkgs) != 2 {
+		t.Fatalf("feed.Latest returned %d packages, want 2", len(pkgs))
+	}
+	for _, pkg := range pkgs {
+		if pkg.Type != FeedName {
+			t.Errorf("Package type %q, want %q", pkg.Type, FeedName)
+		}
+		if !pkg.CreatedDate.After(cutoff) {
+			t.Errorf("Package %s@%s created at %v before cutoff", pkg.Name, pkg.Version, pkg.CreatedDate)
+		}
+	}
+	wantCutoff := time.Date(2021, 5, 11, 18, 32, 1, 0, time.UTC)
+	if !gotCutoff.Equal(wantCutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+
+	// Versions which have already been returned are not returned again when the
+	// same changes are processed.
+	feed.SetCursor("10")
+	pkgs, _, errs = feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 0 {
+		t.Errorf("feed.Latest returned %d packages which were already returned, want 0", len(pkgs))
+	}
+}
+
+func TestChangesLatestHoldsCursorOnRetryableError(t *testing.T) {
+	t.Parallel()
+
+	feed := newTestChangesFeed(t, map[string]testutils.HTTPHandlerFunc{
+		"/_changes":   changesMock,
+		"/FooPackage": fooVersionInfoResponse,
+		"/BarPackage": func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		},
+	})
+	feed.SetCursor("10")
+
+	cutoff := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 1 || !errors.Is(errs[0], utils.ErrUnsuccessfulRequest) {
+		t.Fatalf("feed.Latest returned errors %v, want 1 unsuccessful request", errs)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "FooPackage" {
+		t.Errorf("feed.Latest returned %v, want FooPackage", pkgs)
+	}
+	if feed.Cursor() != "10" {
+		t.Errorf("feed.Cursor() = %q, want the cursor to be held at %q", feed.Cursor(), "10")
+	}
+}
+
+func TestChangesLatestSkipsRepeatedRetryableError(t *testing.T) {
+	t.Parallel()
+
+	feed := newTestChangesFeed(t, map[string]testutils.HTTPHandlerFunc{
+		"/_changes":   changesMock,
+		"/FooPackage": fooVersionInfoResponse,
+		"/BarPackage": func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		},
+	})
+	feed.SetCursor("10")
+
+	// The cursor is held for BarPackage until it has failed maxFetchAttempts times.
+	cutoff := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i < maxFetchAttempts; i++ {
+		if _, _, errs := feed.Latest(context.Background(), cutoff); len(errs) != 1 {
+			t.Fatalf("feed.Latest returned errors %v, want 1", errs)
+		}
+		if feed.Cursor() != "10" {
+			t.Fatalf("feed.Cursor() = %q after %d attempts, want %q", feed.Cursor(), i, "10")
+		}
+	}
+
+	_, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 2 || !errors.Is(errs[1], errFetchAttempts) {
+		t.Fatalf("feed.Latest returned errors %v, want a skipped package", errs)
+	}
+	if feed.Cursor() != "13" {
+		t.Errorf("feed.Cursor() = %q, want %q", feed.Cursor(), "13")
+	}
+	if len(feed.attempts) != 0 {
+		t.Errorf("feed.attempts = %v, want attempts to be reset", feed.attempts)
+	}
+}
+
+func TestChangesLatestSkipsPermanentError(t *testing.T) {
+	t.Parallel()
+
+	feed := newTestChangesFeed(t, map[string]testutils.HTTPHandlerFunc{
+		"/_changes":   changesMock,
+		"/FooPackage": fooVersionInfoResponse,
+		"/BarPackage": testutils.NotFoundHandlerFunc,
+	})
+	feed.SetCursor("10")
+
+	cutoff := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	_, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 1 {
+		t.Fatalf("feed.Latest returned errors %v, want 1", errs)
+	}
+	if feed.Cursor() != "13" {
+		t.Errorf("feed.Cursor() = %q, want %q", feed.Cursor(), "13")
+	}
+}
+
+func TestChangesLatestBacklog(t *testing.T) {
+	t.Parallel()
+
+	// The backlog consists of more pages of changes to CorgePackage than a single
+	// call fetches, followed by a change to FooPackage.
+	backlog := changesLimit * maxChangesPages
+	feed := newTestChangesFeed(t, map[string]testutils.HTTPHandlerFunc{
+		"/_changes": func(w http.ResponseWriter, r *http.Request) {
+			since, err := strconv.Atoi(r.URL.Query().Get("since"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			results := []string{}
+			switch {
+			case since < backlog:
+				for i := 0; i < changesLimit; i++ {
+					results = append(results, `{"id":"CorgePackage"}`)
+				}
+			case since == backlog:
+				results = append(results, `{"id":"FooPackage"}`)
+			}
+			body := fmt.Sprintf(`{"results":[%s],"last_seq":%d}`, strings.Join(results, ","), since+len(results))
+			if _, err := w.Write([]byte(body)); err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+		"/CorgePackage": corgeChangedVersionInfoResponse,
+		"/FooPackage":   fooVersionInfoResponse,
+	})
+	feed.SetCursor("0")
+
+	cutoff := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if feed.Cursor() != strconv.Itoa(backlog) {
+		t.Errorf("feed.Cursor() = %q, want %q", feed.Cursor(), strconv.Itoa(backlog))
+	}
+	if !gotCutoff.Equal(cutoff) {
+		t.Errorf("Latest() cutoff %v, want the cutoff to be held at %v", gotCutoff, cutoff)
+	}
+	got := map[string]bool{}
+	for _, pkg := range pkgs {
+		got[pkg.Name+"@"+pkg.Version] = true
+	}
+
+	pkgs, gotCutoff, errs = feed.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	for _, pkg := range pkgs {
+		got[pkg.Name+"@"+pkg.Version] = true
+	}
+	for _, want := range []string{"CorgePackage@1.0.0", "CorgePackage@2.0.0", "CorgePackage@2.1.0", "FooPackage@1.0.1"} {
+		if !got[want] {
+			t.Errorf("feed.Latest did not return %s, got %v", want, got)
+		}
+	}
+	wantCutoff := time.Date(2021, 5, 11, 18, 32, 1, 0, time.UTC)
+	if !gotCutoff.Equal(wantCutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+}
+
+func TestChangesPackagesOptionUnsupported(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewChangesFeed(feeds.FeedOptions{Packages: &[]string{"foo"}})
+	if !errors.As(err, &feeds.UnsupportedOptionError{}) {
+		t.Errorf("NewChangesFeed returned %v, want an unsupported option error", err)
+	}
+}
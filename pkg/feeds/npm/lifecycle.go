@@ -0,0 +1,101 @@
+package npm
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+// stateLimit defines how many packages the state of the previous poll is
+// remembered for.
+const stateLimit = 10000
+
+// packageState is the state of a package seen by the previous poll, used to
+// detect changes to the package between polls.
+type packageState struct {
+	// versions maps each version of the package to its deprecation message.
+	versions map[string]string
+	// created maps each version of the package to the time it was published.
+	created     map[string]time.Time
+	latest      string
+	unpublished bool
+}
+
+func newPackageState(doc *document) *packageState {
+	state := &packageState{
+		versions:    map[string]string{},
+		created:     map[string]time.Time{},
+		latest:      doc.Latest,
+		unpublished: doc.Unpublished != nil,
+	}
+	for _, pkg := range doc.Versions {
+		state.versions[pkg.Version] = pkg.Deprecated
+		state.created[pkg.Version] = pkg.CreatedDate
+	}
+	return state
+}
+
+// lifecycleEvents compares a package document with the state of the package seen
+// by the previous poll, returning events for a package which was unpublished,
+// versions which were removed or deprecated, and the latest dist-tag being moved
+// to an older version. The first time a package is seen only an unpublish after
+// the cutoff is reported, as the time of the other changes is unknown.
+func (feed Feed) lifecycleEvents(doc *document, cutoff time.Time) []*feeds.Package {
+	prev, seen := feed.states.Get(doc.Title)
+	state := newPackageState(doc)
+	feed.states.Add(doc.Title, state)
+
+	pkgs := []*feeds.Package{}
+	if doc.Unpublished != nil {
+		if (seen && prev.unpublished) || (!seen && !doc.Unpublished.Time.After(cutoff)) {
+			return pkgs
+		}
+		versions := doc.Unpublished.Versions
+		if len(versions) == 0 && seen {
+			versions = sortedKeys(prev.versions)
+		}
+		for _, v := range versions {
+			pkgs = append(pkgs, feeds.NewPackageEvent(doc.Unpublished.Time, doc.Title, v, feeds.UnpublishEvent, FeedName))
+		}
+		return pkgs
+	}
+	if !seen || prev.unpublished {
+		return pkgs
+	}
+
+	// The registry does not record when a version was removed or deprecated, or
+	// when a dist-tag was moved, so these are created at the time the document was
+	// last modified.
+	created := doc.Modified
+	if created.IsZero() {
+		created = time.Now().UTC()
+	}
+	for _, v := range sortedKeys(prev.versions) {
+		if _, ok := state.versions[v]; !ok {
+			pkgs = append(pkgs, feeds.NewPackageEvent(created, doc.Title, v, feeds.DeleteEvent, FeedName))
+		}
+	}
+	for _, v := range sortedKeys(state.versions) {
+		if state.versions[v] != "" && prev.versions[v] == "" {
+			pkgs = append(pkgs, feeds.NewPackageEvent(created, doc.Title, v, feeds.DeprecateEvent, FeedName))
+		}
+	}
+	// The latest dist-tag is moved to an older version when its version is
+	// removed, which is already reported as a removal.
+	latestCreated, ok := state.created[state.latest]
+	prevLatestCreated, prevOK := state.created[prev.latest]
+	if ok && prevOK && latestCreated.Before(prevLatestCreated) {
+		pkgs = append(pkgs, feeds.NewPackageEvent(created, doc.Title, state.latest, feeds.DowngradeEvent, FeedName))
+	}
+	return pkgs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,6 +1,7 @@
 package npm
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
@@ -41,8 +42,7 @@ const (
 )
 
 var (
-	errJSON        = errors.New("error unmarshaling json response internally")
-	errUnpublished = errors.New("package is currently unpublished")
+	errJSON = errors.New("error unmarshaling json response internally")
 )
 
 type Response struct {
@@ -54,6 +54,65 @@ type Package struct {
 	CreatedDate time.Time
 	Version     string
 	Unpublished bool
+	// Deprecated is the deprecation message of the version, if it is deprecated.
+	Deprecated string
+	Tarball    string
+	Integrity  string
+	Shasum     string
+	// InstallScripts is set if the version has a preinstall, install or
+	// postinstall script.
+	InstallScripts bool
+}
+
+// installScripts are the scripts run by npm when a package is installed.
+var installScripts = []string{"preinstall", "install", "postinstall"}
+
+// newPackage creates a feeds.Package for a published version.
+func newPackage(pkg *Package) *feeds.Package {
+	feedPkg := feeds.NewPackage(pkg.CreatedDate, pkg.Title, pkg.Version, FeedName)
+	feedPkg.ArtifactURL = pkg.Tarball
+	if pkg.Shasum != "" {
+		feedPkg.Checksum = "sha1:" + pkg.Shasum
+	}
+	feedPkg.Integrity = pkg.Integrity
+	feedPkg.InstallScripts = pkg.InstallScripts
+	return feedPkg
+}
+
+// document is the part of a package document from the registry used by the feed.
+type document struct {
+	Title string
+	// Versions holds the versions of the package in order of most recent.
+	Versions []*Package
+	// Latest is the version the latest dist-tag points to.
+	Latest string
+	// Modified is the last time the package document was changed.
+	Modified time.Time
+	// Unpublished is set when the package has been entirely unpublished, in which
+	// case there are no versions.
+	Unpublished *unpublished
+}
+
+// unpublished records when a package was entirely unpublished, and the versions
+// which were removed.
+type unpublished struct {
+	Time     time.Time `json:"time"`
+	Versions []string  `json:"versions"`
+}
+
+// deprecation is the deprecation message of a version, the registry holds
+// values other than strings for some versions which are treated as not
+// deprecated.
+type deprecation string
+
+func (d *deprecation) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s, _ := v.(string)
+	*d = deprecation(s)
+	return nil
 }
 
 type PackageEvent struct {
@@ -70,13 +129,13 @@ type cacheEntry struct {
 	// matches.
 	ETag string
 
-	// Versions stores the data retrieved and returned by the fetchPackage
+	// Document stores the data retrieved and returned by the fetchPackage
 	// function below.
-	Versions []*Package
+	Document *document
 }
 
 // Returns a slice of PackageEvent{} structs.
-func fetchPackageEvents(feed Feed) ([]PackageEvent, error) {
+func fetchPackageEvents(ctx context.Context, feed Feed) ([]PackageEvent, error) {
 	pkgURL, err := url.Parse(feed.baseURL)
 	if err != nil {
 		return nil, err
@@ -87,7 +146,11 @@ func fetchPackageEvents(feed Feed) ([]PackageEvent, error) {
 	q.Set("limit", fmt.Sprintf("%d", rssLimit))
 	pkgURL.RawQuery = q.Encode()
 
-	resp, err := feed.client.Get(pkgURL.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pkgURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := feed.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -106,15 +169,15 @@ func fetchPackageEvents(feed Feed) ([]PackageEvent, error) {
 	return rssResponse.PackageEvents, nil
 }
 
-// Gets the package version & corresponding created date from NPM. Returns
-// a slice of {}Package.
-func fetchPackage(feed Feed, pkgTitle string) ([]*Package, error) {
+// Gets the package versions & corresponding created dates from NPM, along with
+// the rest of the package document used to detect changes to the package.
+func fetchPackage(ctx context.Context, feed Feed, pkgTitle string) (*document, error) {
 	versionURL, err := url.JoinPath(feed.baseURL, pkgTitle)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", versionURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, versionURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +199,7 @@ func fetchPackage(feed Feed, pkgTitle string) ([]*Package, error) {
 	if inCache && e != nil && utils.IsNotModified(resp) {
 		// We have a cached value and a 304 was returned, which means we can use
 		// our cached value as the result of this function call.
-		return e.Versions, nil
+		return e.Document, nil
 	}
 	if err := utils.CheckResponseStatus(resp); err != nil {
 		return nil, fmt.Errorf("failed to fetch npm package version data: %w", err)
@@ -150,17 +213,51 @@ func fetchPackage(feed Feed, pkgTitle string) ([]*Package, error) {
 	}
 	etag := resp.Header.Get("etag")
 
-	// We only care about the `time` field as it contains all the versions in
-	// date order, from oldest to newest.
+	doc, err := parseDocument(body, pkgTitle)
+	if err != nil {
+		return nil, err
+	}
+
+	if etag != "" {
+		// Add the result to the cache, only if the the etag is actually present.
+		// An etag should be present, but a server issue may result in the etag
+		// not being included.
+		feed.cache.Add(versionURL, &cacheEntry{
+			ETag:     etag,
+			Document: doc,
+		})
+	}
+
+	return doc, nil
+}
+
+// parseDocument parses the versions of a package from its document.
+func parseDocument(body []byte, pkgTitle string) (*document, error) {
+	// The `time` field contains all the versions in date order, from oldest to
+	// newest. Of the `versions` field only the deprecation message, the artifact
+	// and the scripts are used.
 	// Using a struct for parsing also avoids the cost of deserializing data
 	// that is ultimately unused.
 	var packageDetails struct {
-		Time map[string]interface{} `json:"time"`
+		DistTags struct {
+			Latest string `json:"latest"`
+		} `json:"dist-tags"`
+		Versions map[string]struct {
+			Deprecated deprecation `json:"deprecated"`
+			Dist       struct {
+				Tarball   string `json:"tarball"`
+				Integrity string `json:"integrity"`
+				Shasum    string `json:"shasum"`
+			} `json:"dist"`
+			Scripts map[string]interface{} `json:"scripts"`
+		} `json:"versions"`
+		Time map[string]json.RawMessage `json:"time"`
 	}
 
 	if err := json.Unmarshal(body, &packageDetails); err != nil {
 		return nil, fmt.Errorf("%w : %w for package %s", errJSON, err, pkgTitle)
 	}
+	doc := &document{Title: pkgTitle, Latest: packageDetails.DistTags.Latest}
 	versions := packageDetails.Time
 
 	// If `unpublished` exists in the version map then at a given point in time
@@ -168,10 +265,21 @@ func fetchPackage(feed Feed, pkgTitle string) ([]*Package, error) {
 	// versions that no longer exist. For a given 24h period no further versions can
 	// be uploaded, with any previous versions never being available again.
 	// https://www.npmjs.com/policies/unpublish
-	_, unPublished := versions["unpublished"]
+	if raw, ok := versions["unpublished"]; ok {
+		doc.Unpublished = &unpublished{}
+		if err := json.Unmarshal(raw, doc.Unpublished); err != nil {
+			return nil, fmt.Errorf("%w : %w for package %s", errJSON, err, pkgTitle)
+		}
+		return doc, nil
+	}
 
-	if unPublished {
-		return nil, fmt.Errorf("%s %w", pkgTitle, errUnpublished)
+	// The modified time is only used as the time of changes to the package, so
+	// a missing or malformed value is not an error.
+	if raw, ok := versions["modified"]; ok {
+		var modified time.Time
+		if err := json.Unmarshal(raw, &modified); err == nil {
+			doc.Modified = modified
+		}
 	}
 
 	// Remove redundant entries in map, we're only interested in actual version pairs.
@@ -181,42 +289,52 @@ func fetchPackage(feed Feed, pkgTitle string) ([]*Package, error) {
 	// Create slice of Package{} to allow sorting of a slice, as maps
 	// are unordered.
 	versionSlice := []*Package{}
-	for version, timestamp := range versions {
-		date, err := time.Parse(time.RFC3339, timestamp.(string))
+	for version, raw := range versions {
+		var timestamp string
+		if err := json.Unmarshal(raw, &timestamp); err != nil {
+			return nil, fmt.Errorf("%w : %w for package %s", errJSON, err, pkgTitle)
+		}
+		date, err := time.Parse(time.RFC3339, timestamp)
 		if err != nil {
 			return nil, err
 		}
-		versionSlice = append(versionSlice,
-			&Package{Title: pkgTitle, CreatedDate: date, Version: version})
+		pkg := &Package{Title: pkgTitle, CreatedDate: date, Version: version}
+		// The registry keeps the time of versions which have been unpublished, so
+		// only the versions which are still listed exist.
+		if packageDetails.Versions != nil {
+			v, ok := packageDetails.Versions[version]
+			if !ok {
+				continue
+			}
+			pkg.Deprecated = string(v.Deprecated)
+			pkg.Tarball = v.Dist.Tarball
+			pkg.Integrity = v.Dist.Integrity
+			pkg.Shasum = v.Dist.Shasum
+			for _, script := range installScripts {
+				if cmd, _ := v.Scripts[script].(string); cmd != "" {
+					pkg.InstallScripts = true
+				}
+			}
+		}
+		versionSlice = append(versionSlice, pkg)
 	}
 
 	// Sort slice of versions into order of most recent.
 	sort.SliceStable(versionSlice, func(i, j int) bool {
 		return versionSlice[j].CreatedDate.Before(versionSlice[i].CreatedDate)
 	})
+	doc.Versions = versionSlice
 
-	if etag != "" {
-		// Add the result to the cache, only if the the etag is actually present.
-		// An etag should be present, but a server issue may result in the etag
-		// not being included.
-		feed.cache.Add(versionURL, &cacheEntry{
-			ETag:     etag,
-			Versions: versionSlice,
-		})
-	}
-
-	return versionSlice, nil
+	return doc, nil
 }
 
-func fetchAllPackages(feed Feed) ([]*feeds.Package, []error) {
+func fetchAllPackages(ctx context.Context, feed Feed, cutoff time.Time) ([]*feeds.Package, []*feeds.Package, []error) {
 	pkgs := []*feeds.Package{}
 	errs := []error{}
-	packageChannel := make(chan []*Package)
-	errChannel := make(chan error)
-	packageEvents, err := fetchPackageEvents(feed)
+	packageEvents, err := fetchPackageEvents(ctx, feed)
 	if err != nil {
 		// If we can't generate package events then return early.
-		return pkgs, append(errs, err)
+		return pkgs, nil, append(errs, err)
 	}
 	// Handle the possibility of multiple releases of the same package
 	// within the polled `packages` slice.
@@ -225,34 +343,39 @@ func fetchAllPackages(feed Feed) ([]*feeds.Package, []error) {
 		uniquePackages[pkg.Title]++
 	}
 
+	npmPkgs, lifecycle, errs := fetchPackages(ctx, feed, uniquePackages, cutoff)
+	for _, pkg := range npmPkgs {
+		pkgs = append(pkgs, newPackage(pkg))
+	}
+	return pkgs, lifecycle, errs
+}
+
+// fetchPackages fetches the versions of each of the given packages using a pool
+// of workers. At most count of the most recent versions of each package are
+// returned, or all versions if count is zero, along with the lifecycle events
+// of each package.
+func fetchPackages(
+	ctx context.Context, feed Feed, uniquePackages map[string]int, cutoff time.Time,
+) ([]*Package, []*feeds.Package, []error) {
+	pkgs := []*Package{}
+	lifecycle := []*feeds.Package{}
+	errs := []error{}
+	packageChannel := make(chan *document)
+	errChannel := make(chan error)
+
 	// Start a collection of workers to fetch all the packages.
 	// This limits the number of concurrent requests to avoid flooding the NPM
 	// registry API with too many simultaneous requests.
-	workChannel := make(chan struct {
-		pkgTitle string
-		count    int
-	})
+	workChannel := make(chan string)
 
 	// Define the fetcher function that grabs the repos from NPM
-	fetcherFn := func(pkgTitle string, count int) {
-		pkgs, err := fetchPackage(feed, pkgTitle)
+	fetcherFn := func(pkgTitle string) {
+		doc, err := fetchPackage(ctx, feed, pkgTitle)
 		if err != nil {
-			if !errors.Is(err, errUnpublished) {
-				err = feeds.PackagePollError{Name: pkgTitle, Err: err}
-			}
-			errChannel <- err
+			errChannel <- feeds.PackagePollError{Name: pkgTitle, Err: err}
 			return
 		}
-		// Apply count slice, guard against a given events corresponding
-		// version entry being unpublished by the time the specific
-		// endpoint has been processed. This seemingly happens silently
-		// without being recorded in the json. An `event` could be logged
-		// here.
-		if len(pkgs) > count {
-			packageChannel <- pkgs[:count]
-		} else {
-			packageChannel <- pkgs
-		}
+		packageChannel <- doc
 	}
 
 	// The WaitGroup is used to ensure all the goroutines are complete before
@@ -265,12 +388,12 @@ func fetchAllPackages(feed Feed) ([]*feeds.Package, []error) {
 		go func() {
 			defer wg.Done()
 			for {
-				w, more := <-workChannel
+				pkgTitle, more := <-workChannel
 				if !more {
 					// If we have no more work then return.
 					return
 				}
-				fetcherFn(w.pkgTitle, w.count)
+				fetcherFn(pkgTitle)
 			}
 		}()
 	}
@@ -278,11 +401,8 @@ func fetchAllPackages(feed Feed) ([]*feeds.Package, []error) {
 	// Start a goroutine to push work to the workers.
 	go func() {
 		// Populate the worker feed.
-		for pkgTitle, count := range uniquePackages {
-			workChannel <- struct {
-				pkgTitle string
-				count    int
-			}{pkgTitle: pkgTitle, count: count}
+		for pkgTitle := range uniquePackages {
+			workChannel <- pkgTitle
 		}
 
 		// Close the channel to indicate that there is no more work.
@@ -292,63 +412,60 @@ func fetchAllPackages(feed Feed) ([]*feeds.Package, []error) {
 	// Collect all the work.
 	for i := 0; i < len(uniquePackages); i++ {
 		select {
-		case npmPkgs := <-packageChannel:
-			for _, pkg := range npmPkgs {
-				feedPkg := feeds.NewPackage(pkg.CreatedDate, pkg.Title,
-					pkg.Version, FeedName)
-				pkgs = append(pkgs, feedPkg)
+		case doc := <-packageChannel:
+			// Apply count slice, guard against a given events corresponding
+			// version entry being unpublished by the time the specific
+			// endpoint has been processed. Removed versions are reported by
+			// the lifecycle events once the package has been seen.
+			count := uniquePackages[doc.Title]
+			if count > 0 && len(doc.Versions) > count {
+				pkgs = append(pkgs, doc.Versions[:count]...)
+			} else {
+				pkgs = append(pkgs, doc.Versions...)
 			}
+			lifecycle = append(lifecycle, feed.lifecycleEvents(doc, cutoff)...)
 		case err := <-errChannel:
-			// When polling the 'firehose' unpublished packages
-			// don't need to be logged as an error.
-			if !errors.Is(err, errUnpublished) {
-				errs = append(errs, err)
-			}
+			errs = append(errs, err)
 		}
 	}
 
 	wg.Wait()
 
-	return pkgs, errs
+	return pkgs, lifecycle, errs
 }
 
-func fetchCriticalPackages(feed Feed, packages []string) ([]*feeds.Package, []error) {
+func fetchCriticalPackages(
+	ctx context.Context, feed Feed, packages []string, cutoff time.Time,
+) ([]*feeds.Package, []*feeds.Package, []error) {
 	pkgs := []*feeds.Package{}
+	lifecycle := []*feeds.Package{}
 	errs := []error{}
-	packageChannel := make(chan []*Package)
+	packageChannel := make(chan *document)
 	errChannel := make(chan error)
 
 	for _, pkgTitle := range packages {
 		go func(pkgTitle string) {
-			pkgs, err := fetchPackage(feed, pkgTitle)
+			doc, err := fetchPackage(ctx, feed, pkgTitle)
 			if err != nil {
-				if !errors.Is(err, errUnpublished) {
-					err = feeds.PackagePollError{Name: pkgTitle, Err: err}
-				}
-				errChannel <- err
+				errChannel <- feeds.PackagePollError{Name: pkgTitle, Err: err}
 				return
 			}
-			packageChannel <- pkgs
+			packageChannel <- doc
 		}(pkgTitle)
 	}
 
 	for i := 0; i < len(packages); i++ {
 		select {
-		case npmPkgs := <-packageChannel:
-			for _, pkg := range npmPkgs {
-				feedPkg := feeds.NewPackage(pkg.CreatedDate, pkg.Title,
-					pkg.Version, FeedName)
-				pkgs = append(pkgs, feedPkg)
+		case doc := <-packageChannel:
+			for _, pkg := range doc.Versions {
+				pkgs = append(pkgs, newPackage(pkg))
 			}
+			lifecycle = append(lifecycle, feed.lifecycleEvents(doc, cutoff)...)
 		case err := <-errChannel:
-			// Assume if a package has been unpublished that it is a valid reason
-			// to log the error when polling for 'critical' packages. This could
-			// be changed for a 'lossy' type event instead. Further packages should
-			// be proccessed.
 			errs = append(errs, err)
 		}
 	}
-	return pkgs, errs
+	return pkgs, lifecycle, errs
 }
 
 type Feed struct {
@@ -358,6 +475,10 @@ type Feed struct {
 	options          feeds.FeedOptions
 	client           *http.Client
 	cache            *lru.Cache[string, *cacheEntry]
+
+	// states holds the state of each package seen by previous polls, used to
+	// detect changes to packages between polls.
+	states *lru.Cache[string, *packageState]
 }
 
 func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, error) {
@@ -377,6 +498,10 @@ func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, er
 	if err != nil {
 		return nil, err
 	}
+	states, err := lru.New[string, *packageState](stateLimit)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Feed{
 		packages:         feedOptions.Packages,
@@ -390,21 +515,23 @@ func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, er
 			},
 			Timeout: 45 * time.Second,
 		},
-		cache: cache,
+		cache:  cache,
+		states: states,
 	}, nil
 }
 
-func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+func (feed Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
 	var pkgs []*feeds.Package
+	var lifecycle []*feeds.Package
 	var errs []error
 
 	if feed.packages == nil {
-		pkgs, errs = fetchAllPackages(feed)
+		pkgs, lifecycle, errs = fetchAllPackages(ctx, feed, cutoff)
 	} else {
-		pkgs, errs = fetchCriticalPackages(feed, *feed.packages)
+		pkgs, lifecycle, errs = fetchCriticalPackages(ctx, feed, *feed.packages, cutoff)
 	}
 
-	if len(pkgs) == 0 {
+	if len(pkgs) == 0 && len(lifecycle) == 0 {
 		// If none of the packages were successfully polled for, return early.
 		return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
 	}
@@ -415,18 +542,17 @@ func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
 		return pkgs[j].CreatedDate.Before(pkgs[i].CreatedDate)
 	})
 
-	// After sorting the first entry should be the largest.
-	newCutoff := pkgs[0].CreatedDate
+	// Lifecycle events are found by comparing packages with the previous poll
+	// rather than by their time, so only published versions are subject to and
+	// move the cutoff.
+	newCutoff := feeds.FindCutoff(cutoff, pkgs)
 
-	// TODO: Add an event for checking if the previous package list contains entries
-	// that do not exist in the latest package list when polling for critical packages.
-	// This can highlight cases where specific versions have been unpublished.
 	if feed.packages == nil {
-		feed.lossyFeedAlerter.ProcessPackages(FeedName, pkgs)
+		feed.lossyFeedAlerter.ProcessPackages(feed.options.InstanceName(FeedName), pkgs)
 	}
 
 	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
-	return pkgs, newCutoff, errs
+	return append(pkgs, lifecycle...), newCutoff, errs
 }
 
 func (feed Feed) GetName() string {
@@ -1,10 +1,12 @@
 package npm
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -35,7 +37,7 @@ func TestNpmLatest(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
 	}
@@ -115,8 +117,15 @@ func TestNpmLatest(t *testing.T) {
 		t.Errorf("Unexpected created date `%s` found in place of expected `2021-05-11T14:15:43.000Z`", pkgs[3].CreatedDate)
 	}
 
-	if len(pkgs) != 5 {
-		t.Errorf("Unexpected amount of *feed.Package{} generated: %v", len(pkgs))
+	// QuxPackage was unpublished, so each of its versions is returned as an event
+	// after the published versions.
+	if len(pkgs) != 7 {
+		t.Fatalf("Unexpected amount of *feed.Package{} generated: %v", len(pkgs))
+	}
+	for _, pkg := range pkgs[5:] {
+		if pkg.Name != "QuxPackage" || pkg.Event != feeds.UnpublishEvent {
+			t.Errorf("Unexpected package %v found in place of expected QuxPackage unpublish", pkg)
+		}
 	}
 }
 
@@ -142,7 +151,7 @@ func TestNpmCritical(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("Failed to call Latest() with err: %v", errs[len(errs)-1])
 	}
@@ -204,25 +213,192 @@ func TestNpmCriticalUnpublished(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, _, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest() returned error: %v", errs[len(errs)-1])
+	}
 
-	if len(errs) != 1 {
-		t.Fatalf("feed.Latest() returned %v errors when 1 was expected", len(errs))
+	// FooPackage should still be processed, and each version of QuxPackage is
+	// returned as unpublished instead.
+	if len(pkgs) != 5 {
+		t.Fatalf("Latest() produced %v packages instead of the expected 5", len(pkgs))
+	}
+	unpublishedTime := time.Date(2021, 5, 11, 14, 17, 12, 0, time.UTC)
+	for i, version := range []string{"1.0", "1.1"} {
+		pkg := pkgs[3+i]
+		if pkg.Name != "QuxPackage" || pkg.Version != version || pkg.Event != feeds.UnpublishEvent {
+			t.Errorf("Latest() returned %v, want QuxPackage %v %v", pkg, version, feeds.UnpublishEvent)
+		}
+		if !pkg.CreatedDate.Equal(unpublishedTime) {
+			t.Errorf("Unpublish created at %v, want %v", pkg.CreatedDate, unpublishedTime)
+		}
 	}
 
-	if !errors.Is(errs[len(errs)-1], errUnpublished) {
-		t.Fatalf("Failed to return unpublished error when polling for an unpublished package, instead: %v", err)
+	// The unpublish should not move the cutoff.
+	wantCutoff := time.Date(2021, 5, 11, 18, 32, 1, 0, time.UTC)
+	if gotCutoff != wantCutoff {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
 	}
 
-	if !strings.Contains(errs[len(errs)-1].Error(), "QuxPackage") {
-		t.Fatalf("Failed to correctly include the package name in unpublished error, instead: %v", errs[len(errs)-1])
+	// The unpublish is only returned once.
+	pkgs, _, errs = feed.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest() returned error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 0 {
+		t.Errorf("Latest() produced %v packages instead of the expected 0", len(pkgs))
 	}
+}
 
-	// Even though QuxPackage is unpublished, the error should be
-	// logged and FooPackage should still be processed.
+func TestNpmCriticalArtifacts(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/CorgePackage": corgeVersionInfoResponse,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	packages := []string{"CorgePackage"}
+	feed, err := New(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create new npm feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest() returned error: %v", errs[len(errs)-1])
+	}
 	if len(pkgs) != 3 {
 		t.Fatalf("Latest() produced %v packages instead of the expected 3", len(pkgs))
 	}
+
+	want := []feeds.Package{
+		{
+			Version:        "2.0.0",
+			ArtifactURL:    "https://registry.npmjs.org/CorgePackage/-/CorgePackage-2.0.0.tgz",
+			Checksum:       "sha1:9f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a",
+			Integrity:      "sha512-q2lIyzhDTAY5wIZDEj0wGDaSv7F+L3GZdmk4nXd9MQhXZhTrn91JcKUvJYUfWAKcf2FRkm1rZ9UCQjNY9Gbj+A==",
+			InstallScripts: true,
+		},
+		{
+			Version: "1.1.0",
+		},
+		{
+			// Empty install scripts are not run.
+			Version:     "1.0.0",
+			ArtifactURL: "https://registry.npmjs.org/CorgePackage/-/CorgePackage-1.0.0.tgz",
+			Checksum:    "sha1:3b3c6e2c4aa5a1a4b1f9c0e2d7f8a9b0c1d2e3f4",
+		},
+	}
+	for i, pkg := range pkgs {
+		if pkg.Version != want[i].Version {
+			t.Errorf("Latest() version %v, want %v", pkg.Version, want[i].Version)
+		}
+		if pkg.ArtifactURL != want[i].ArtifactURL {
+			t.Errorf("%v artifact URL %q, want %q", pkg.Version, pkg.ArtifactURL, want[i].ArtifactURL)
+		}
+		if pkg.Checksum != want[i].Checksum {
+			t.Errorf("%v checksum %q, want %q", pkg.Version, pkg.Checksum, want[i].Checksum)
+		}
+		if pkg.Integrity != want[i].Integrity {
+			t.Errorf("%v integrity %q, want %q", pkg.Version, pkg.Integrity, want[i].Integrity)
+		}
+		if pkg.InstallScripts != want[i].InstallScripts {
+			t.Errorf("%v install scripts %v, want %v", pkg.Version, pkg.InstallScripts, want[i].InstallScripts)
+		}
+	}
+}
+
+func TestNpmCriticalLifecycleEvents(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/CorgePackage": func(w http.ResponseWriter, r *http.Request) {
+			switch polls.Add(1) {
+			case 1:
+				corgeVersionInfoResponse(w, r)
+			case 2:
+				corgeChangedVersionInfoResponse(w, r)
+			default:
+				corgeUnpublishedVersionInfoResponse(w, r)
+			}
+		},
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	packages := []string{"CorgePackage"}
+	feed, err := New(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create new npm feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	// Existing deprecations are not reported the first time a package is seen,
+	// and versions which are no longer listed are not returned.
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, cutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest() returned error: %v", errs[len(errs)-1])
+	}
+	got := []string{}
+	for _, pkg := range pkgs {
+		got = append(got, pkg.Version+" "+pkg.Event)
+	}
+	want := []string{"2.0.0 ", "1.1.0 ", "1.0.0 "}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("First Latest() returned %v, want %v", got, want)
+	}
+
+	// 1.1.0 is removed, 1.0.0 is deprecated, 2.1.0 is published and the latest
+	// dist-tag is moved back to 1.0.0.
+	pkgs, cutoff, errs = feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest() returned error: %v", errs[len(errs)-1])
+	}
+	got = []string{}
+	for _, pkg := range pkgs {
+		got = append(got, pkg.Version+" "+pkg.Event)
+	}
+	want = []string{
+		"2.1.0 ",
+		"1.1.0 " + feeds.DeleteEvent,
+		"1.0.0 " + feeds.DeprecateEvent,
+		"1.0.0 " + feeds.DowngradeEvent,
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Second Latest() returned %v, want %v", got, want)
+	}
+	modified := time.Date(2021, 6, 2, 9, 0, 0, 0, time.UTC)
+	for _, pkg := range pkgs[1:] {
+		if !pkg.CreatedDate.Equal(modified) {
+			t.Errorf("Event %v created at %v, want %v", pkg.Event, pkg.CreatedDate, modified)
+		}
+	}
+	wantCutoff := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	if cutoff != wantCutoff {
+		t.Errorf("Latest() cutoff %v, want %v", cutoff, wantCutoff)
+	}
+
+	// The whole package is unpublished.
+	pkgs, _, errs = feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest() returned error: %v", errs[len(errs)-1])
+	}
+	got = []string{}
+	for _, pkg := range pkgs {
+		got = append(got, pkg.Version+" "+pkg.Event)
+	}
+	want = []string{
+		"1.0.0 " + feeds.UnpublishEvent,
+		"2.0.0 " + feeds.UnpublishEvent,
+		"2.1.0 " + feeds.UnpublishEvent,
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Third Latest() returned %v, want %v", got, want)
+	}
 }
 
 func TestNpmNonUtf8Response(t *testing.T) {
@@ -233,7 +409,7 @@ func TestNpmNonUtf8Response(t *testing.T) {
 	}
 	srv := testutils.HTTPServerMock(handlers)
 
-	pkgs, err := fetchPackageEvents(Feed{client: http.DefaultClient, baseURL: srv.URL})
+	pkgs, err := fetchPackageEvents(context.Background(), Feed{client: http.DefaultClient, baseURL: srv.URL})
 	if err != nil {
 		t.Fatalf("Failed to fetch packages: %v", err)
 	}
@@ -255,7 +431,7 @@ func TestNpmNonXMLResponse(t *testing.T) {
 	}
 	srv := testutils.HTTPServerMock(handlers)
 
-	pkgs, err := fetchPackageEvents(Feed{client: http.DefaultClient, baseURL: srv.URL})
+	pkgs, err := fetchPackageEvents(context.Background(), Feed{client: http.DefaultClient, baseURL: srv.URL})
 	if err != nil {
 		t.Fatalf("Failed to fetch packages: %v", err)
 	}
@@ -286,7 +462,7 @@ func TestNpmNotFound(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	_, gotCutoff, errs := feed.Latest(cutoff)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if cutoff != gotCutoff {
 		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
 	}
@@ -319,7 +495,7 @@ func TestNpmPartialNotFound(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, _, errs := feed.Latest(cutoff)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 1 {
 		t.Fatalf("feed.Latest() returned %v errors when 1 was expected", len(errs))
 	}
@@ -358,7 +534,7 @@ func TestNpmCriticalPartialNotFound(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, _, errs := feed.Latest(cutoff)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 1 {
 		t.Fatalf("feed.Latest() returned %v errors when 1 was expected", len(errs))
 	}
@@ -490,8 +666,8 @@ func bazVersionInfoResponse(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-// QuxPackage has an `unpublished` field, this should't cause an error if polling
-// the 'firehose' but a *feeds.Package{} should not be generated. Completely
+// QuxPackage has an `unpublished` field, this shouldn't cause an error but each
+// of the unpublished versions should be returned as an unpublish event. Completely
 // unpublishing a package entails there's a minimum of 24hours before a new version
 // of it may be published.
 func quxVersionInfoResponse(w http.ResponseWriter, _ *http.Request) {
@@ -543,6 +719,101 @@ func quuxVersionInfoResponse(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// CorgePackage lists the versions of the package, the time of 1.1.0 is kept
+// although it is no longer listed, as it was unpublished.
+func corgeVersionInfoResponse(w http.ResponseWriter, _ *http.Request) {
+	_, err := w.Write([]byte(`
+{
+	"name": "CorgePackage",
+	"dist-tags": {
+		"latest": "2.0.0"
+	},
+	"versions": {
+		"1.0.0": {
+			"name": "CorgePackage",
+			"version": "1.0.0",
+			"deprecated": false,
+			"scripts": {"test": "mocha", "install": "", "prepare": "tsc"},
+			"dist": {
+				"tarball": "https://registry.npmjs.org/CorgePackage/-/CorgePackage-1.0.0.tgz",
+				"shasum": "3b3c6e2c4aa5a1a4b1f9c0e2d7f8a9b0c1d2e3f4"
+			}
+		},
+		"1.1.0": {"name": "CorgePackage", "version": "1.1.0", "deprecated": "use 2.0.0"},
+		"2.0.0": {
+			"name": "CorgePackage",
+			"version": "2.0.0",
+			"scripts": {"postinstall": "node setup.js"},
+			"dist": {
+				"tarball": "https://registry.npmjs.org/CorgePackage/-/CorgePackage-2.0.0.tgz",
+				"integrity": "sha512-q2lIyzhDTAY5wIZDEj0wGDaSv7F+L3GZdmk4nXd9MQhXZhTrn91JcKUvJYUfWAKcf2FRkm1rZ9UCQjNY9Gbj+A==",
+				"shasum": "9f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a"
+			}
+		}
+	},
+	"time": {
+		"created": "2021-05-01T12:00:00.000Z",
+		"modified": "2021-05-03T12:00:00.000Z",
+		"0.9.0": "2021-04-30T12:00:00.000Z",
+		"1.0.0": "2021-05-01T12:00:00.000Z",
+		"1.1.0": "2021-05-02T12:00:00.000Z",
+		"2.0.0": "2021-05-03T12:00:00.000Z"
+	}
+}
+`))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
+func corgeChangedVersionInfoResponse(w http.ResponseWriter, _ *http.Request) {
+	_, err := w.Write([]byte(`
+{
+	"name": "CorgePackage",
+	"dist-tags": {
+		"latest": "1.0.0"
+	},
+	"versions": {
+		"1.0.0": {"name": "CorgePackage", "version": "1.0.0", "deprecated": "use 2.1.0"},
+		"2.0.0": {"name": "CorgePackage", "version": "2.0.0"},
+		"2.1.0": {"name": "CorgePackage", "version": "2.1.0"}
+	},
+	"time": {
+		"created": "2021-05-01T12:00:00.000Z",
+		"modified": "2021-06-02T09:00:00.000Z",
+		"0.9.0": "2021-04-30T12:00:00.000Z",
+		"1.0.0": "2021-05-01T12:00:00.000Z",
+		"1.1.0": "2021-05-02T12:00:00.000Z",
+		"2.0.0": "2021-05-03T12:00:00.000Z",
+		"2.1.0": "2021-06-01T12:00:00.000Z"
+	}
+}
+`))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
+func corgeUnpublishedVersionInfoResponse(w http.ResponseWriter, _ *http.Request) {
+	_, err := w.Write([]byte(`
+{
+	"name": "CorgePackage",
+	"time": {
+		"created": "2021-05-01T12:00:00.000Z",
+		"modified": "2021-06-03T12:00:00.000Z",
+		"unpublished": {
+			"name": "CorgeMan",
+			"time": "2021-06-03T12:00:00.000Z",
+			"versions": ["1.0.0", "2.0.0", "2.1.0"]
+		}
+	}
+}
+`))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
 func nonUtf8Response(w http.ResponseWriter, _ *http.Request) {
 	_, err := w.Write([]byte(`
 <?xml version="1.0" encoding="UTF-8"?><rss>
@@ -0,0 +1,12 @@
+package nuget
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var editsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "package_feeds",
+	Name:      "nuget_edits_skipped_total",
+	Help:      "Number of nuget catalog leaves skipped as edits of versions published long before their commit.",
+}, []string{"feed"})
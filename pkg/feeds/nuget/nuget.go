@@ -1,13 +1,19 @@
 package nuget
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	log "github.com/sirupsen/logrus"
+
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/useragent"
 	"github.com/ossf/package-feeds/pkg/utils"
@@ -17,6 +23,25 @@ const (
 	FeedName           = "nuget"
 	catalogServiceType = "Catalog/3.0.0"
 	indexPath          = "/v3/index.json"
+
+	// The types of the registration resource in order of preference, the 3.6.0
+	// resource includes SemVer 2.0.0 versions.
+	registrationsServiceType       = "RegistrationsBaseUrl/3.6.0"
+	legacyRegistrationsServiceType = "RegistrationsBaseUrl"
+
+	// maxCatalogPages bounds the number of catalog pages fetched by each call to
+	// Latest, older cutoffs are paged through by subsequent calls.
+	maxCatalogPages = 20
+
+	// fetchWorkers defines the total number of concurrent requests for catalog
+	// leaves to allow at any one time.
+	fetchWorkers = 10
+
+	// maxPublishDelay is how long after a version is published that it may first
+	// appear in the catalog. Leaves for versions published longer before their
+	// commit are edits of existing versions, such as listing changes, and are
+	// skipped.
+	maxPublishDelay = 24 * time.Hour
 )
 
 var (
@@ -24,7 +49,7 @@ var (
 		Transport: &useragent.RoundTripper{UserAgent: feeds.DefaultUserAgent},
 		Timeout:   10 * time.Second,
 	}
-	errCatalogService = errors.New("error fetching catalog service")
+	errServiceNotFound = errors.New("could not locate service for nuget feed")
 )
 
 type serviceIndex struct {
@@ -50,6 +75,24 @@ type catalogLeaf struct {
 	URI            string    `json:"@id"`
 	CatalogCreated time.Time `json:"commitTimeStamp"`
 	Type           string    `json:"@type"`
+	PackageID      string    `json:"nuget:id"`
+	Version        string    `json:"nuget:version"`
+}
+
+type registrationIndex struct {
+	Pages []*registrationPage `json:"items"`
+}
+
+// registrationPage holds the versions of a package within a range of versions.
+// The leaves are omitted from the registration index for packages with many
+// versions, and must be fetched from the page's URI.
+type registrationPage struct {
+	URI    string              `json:"@id"`
+	Leaves []*registrationLeaf `json:"items"`
+}
+
+type registrationLeaf struct {
+	CatalogEntry nugetPackageDetails `json:"catalogEntry"`
 }
 
 type nugetPackageDetails struct {
@@ -58,13 +101,21 @@ type nugetPackageDetails struct {
 	Created   time.Time `json:"published"`
 }
 
-func fetchCatalogService(baseURL string) (*nugetService, error) {
+func httpGet(ctx context.Context, getURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpClient.Do(req)
+}
+
+func fetchServices(ctx context.Context, baseURL string) ([]*nugetService, error) {
 	var err error
-	catalogServiceURL, err := url.JoinPath(baseURL, indexPath)
+	serviceIndexURL, err := url.JoinPath(baseURL, indexPath)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := httpClient.Get(catalogServiceURL)
+	resp, err := httpGet(ctx, serviceIndexURL)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +124,7 @@ func fetchCatalogService(baseURL string) (*nugetService, error) {
 
 	err = utils.CheckResponseStatus(resp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch nuget catalog service: %w", err)
+		return nil, fmt.Errorf("failed to fetch nuget service index: %w", err)
 	}
 
 	directory := &serviceIndex{}
@@ -82,17 +133,11 @@ func fetchCatalogService(baseURL string) (*nugetService, error) {
 		return nil, err
 	}
 
-	for _, service := range directory.Services {
-		if service.Type == catalogServiceType {
-			return service, nil
-		}
-	}
-	return nil, fmt.Errorf("%w : could not locate catalog service for nuget feed %s",
-		errCatalogService, catalogServiceURL)
+	return directory.Services, nil
 }
 
-func fetchCatalogPages(catalogURL string) ([]*catalogPage, error) {
-	resp, err := httpClient.Get(catalogURL)
+func fetchCatalogPages(ctx context.Context, catalogURL string) ([]*catalogPage, error) {
+	resp, err := httpGet(ctx, catalogURL)
 	if err != nil {
 		return nil, err
 	}
@@ -113,8 +158,8 @@ func fetchCatalogPages(catalogURL string) ([]*catalogPage, error) {
 	return c.Pages, nil
 }
 
-func fetchCatalogPage(catalogURL string) ([]*catalogLeaf, error) {
-	resp, err := httpClient.Get(catalogURL)
+func fetchCatalogPage(ctx context.Context, catalogURL string) ([]*catalogLeaf, error) {
+	resp, err := httpGet(ctx, catalogURL)
 	if err != nil {
 		return nil, err
 	}
@@ -135,8 +180,72 @@ func fetchCatalogPage(catalogURL string) ([]*catalogLeaf, error) {
 	return page.Packages, nil
 }
 
-func fetchPackageInfo(infoURL string) (*nugetPackageDetails, error) {
-	resp, err := httpClient.Get(infoURL)
+func fetchRegistrationPage(ctx context.Context, pageURL string) ([]*registrationLeaf, error) {
+	resp, err := httpGet(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	err = utils.CheckResponseStatus(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch nuget registration page: %w", err)
+	}
+
+	page := &registrationPage{}
+	err = json.NewDecoder(resp.Body).Decode(page)
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Leaves, nil
+}
+
+// fetchRegistration returns the details of every version of a package from the
+// registration resource.
+func fetchRegistration(ctx context.Context, registrationsURL, packageID string) ([]*nugetPackageDetails, error) {
+	// Package IDs are lower cased in registration URLs.
+	indexURL, err := url.JoinPath(registrationsURL, strings.ToLower(packageID), "index.json")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpGet(ctx, indexURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	err = utils.CheckResponseStatus(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch nuget registration: %w", err)
+	}
+
+	index := &registrationIndex{}
+	err = json.NewDecoder(resp.Body).Decode(index)
+	if err != nil {
+		return nil, err
+	}
+
+	details := []*nugetPackageDetails{}
+	for _, page := range index.Pages {
+		leaves := page.Leaves
+		if leaves == nil {
+			leaves, err = fetchRegistrationPage(ctx, page.URI)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, leaf := range leaves {
+			details = append(details, &leaf.CatalogEntry)
+		}
+	}
+	return details, nil
+}
+
+func fetchPackageInfo(ctx context.Context, infoURL string) (*nugetPackageDetails, error) {
+	resp, err := httpGet(ctx, infoURL)
 	if err != nil {
 		return nil, err
 	}
@@ -157,81 +266,365 @@ func fetchPackageInfo(infoURL string) (*nugetPackageDetails, error) {
 	return packageDetail, nil
 }
 
-type Feed struct {
-	baseURL string
-	options feeds.FeedOptions
+// fetchLeaves fetches the package details of each PackageDetails leaf using a
+// pool of workers. The details and errors are returned in the same order as
+// the leaves, leaves of other types have neither.
+func fetchLeaves(ctx context.Context, leaves []*catalogLeaf) ([]*nugetPackageDetails, []error) {
+	details := make([]*nugetPackageDetails, len(leaves))
+	errs := make([]error, len(leaves))
+	workChannel := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < fetchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range workChannel {
+				details[i], errs[i] = fetchPackageInfo(ctx, leaves[i].URI)
+			}
+		}()
+	}
+
+	for i, leaf := range leaves {
+		if leaf.Type == "nuget:PackageDetails" {
+			workChannel <- i
+		}
+	}
+	close(workChannel)
+	wg.Wait()
+
+	return details, errs
 }
 
-func New(feedOptions feeds.FeedOptions) (*Feed, error) {
-	if feedOptions.Packages != nil {
-		return nil, feeds.UnsupportedOptionError{
-			Feed:   FeedName,
-			Option: "packages",
+// leavesAfter returns the leaves committed after the cursor, in commit order.
+func leavesAfter(leaves []*catalogLeaf, cursor time.Time) []*catalogLeaf {
+	filtered := []*catalogLeaf{}
+	for _, leaf := range leaves {
+		if leaf.CatalogCreated.After(cursor) {
+			filtered = append(filtered, leaf)
 		}
 	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].CatalogCreated.Before(filtered[j].CatalogCreated)
+	})
+	return filtered
+}
+
+type Feed struct {
+	baseURL  string
+	packages *[]string
+	options  feeds.FeedOptions
+
+	// mu guards cursor, which is read when checkpointing outside of polling,
+	// services, which holds the resources of the service index, and known, which
+	// holds the versions of each package listed by the previous poll when the
+	// packages option is set.
+	mu       sync.Mutex
+	cursor   string
+	services []*nugetService
+	known    map[string]map[string]bool
+}
+
+func New(feedOptions feeds.FeedOptions) (*Feed, error) {
 	return &Feed{
-		baseURL: "https://api.nuget.org/",
-		options: feedOptions,
+		baseURL:  "https://api.nuget.org/",
+		packages: feedOptions.Packages,
+		options:  feedOptions,
+		known:    map[string]map[string]bool{},
 	}, nil
 }
 
-// Latest will parse all creation events for packages in the nuget.org catalog feed
-// for packages that have been published since the cutoff
+// service returns the URL of the first resource found in the service index of
+// the given types, in order of preference. The service index is only fetched
+// the first time it is successfully fetched.
+func (feed *Feed) service(ctx context.Context, serviceTypes ...string) (string, error) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	if feed.services == nil {
+		services, err := fetchServices(ctx, feed.baseURL)
+		if err != nil {
+			return "", err
+		}
+		feed.services = services
+	}
+	for _, serviceType := range serviceTypes {
+		for _, service := range feed.services {
+			if service.Type == serviceType {
+				return service.URI, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w : %v", errServiceNotFound, strings.Join(serviceTypes, ", "))
+}
+
+// diffVersions compares the versions of a package with those listed by the
+// previous poll, returning the versions which were added along with delete events
+// for the versions which were removed. The first time a package is polled, only
+// the versions published after the cutoff are returned.
+func (feed *Feed) diffVersions(
+	packageID string, details []*nugetPackageDetails, cutoff time.Time,
+) ([]*feeds.Package, []*feeds.Package) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	known, seen := feed.known[packageID]
+	current := map[string]bool{}
+	releases := []*feeds.Package{}
+	for _, d := range details {
+		current[d.Version] = true
+		if (seen && known[d.Version]) || (!seen && !d.Created.After(cutoff)) {
+			continue
+		}
+		releases = append(releases, feeds.NewPackage(d.Created, d.PackageID, d.Version, FeedName))
+	}
+	feed.known[packageID] = current
+
+	// The registration resource does not record when a version was deleted, so
+	// deletes are created at the time they were detected.
+	now := time.Now().UTC()
+	deletes := []*feeds.Package{}
+	for _, v := range sortedKeys(known) {
+		if !current[v] {
+			deletes = append(deletes, feeds.NewPackageEvent(now, packageID, v, feeds.DeleteEvent, FeedName))
+		}
+	}
+	return releases, deletes
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fetchCriticalPackages polls the versions of each of the given packages from
+// the registration resource concurrently, returning the versions which were
+// published along with the versions which were deleted.
+func (feed *Feed) fetchCriticalPackages(
+	ctx context.Context, packageIDs []string, cutoff time.Time,
+) ([]*feeds.Package, []*feeds.Package, []error) {
+	releases := []*feeds.Package{}
+	deletes := []*feeds.Package{}
+	errs := []error{}
+
+	registrationsURL, err := feed.service(ctx, registrationsServiceType, legacyRegistrationsServiceType)
+	if err != nil {
+		for _, packageID := range packageIDs {
+			errs = append(errs, feeds.PackagePollError{Name: packageID, Err: err})
+		}
+		return releases, deletes, errs
+	}
+
+	detailsChannel := make(chan struct {
+		packageID string
+		details   []*nugetPackageDetails
+	})
+	errChannel := make(chan error)
+	for _, packageID := range packageIDs {
+		go func(packageID string) {
+			details, err := fetchRegistration(ctx, registrationsURL, packageID)
+			if err != nil {
+				errChannel <- feeds.PackagePollError{Name: packageID, Err: err}
+				return
+			}
+			detailsChannel <- struct {
+				packageID string
+				details   []*nugetPackageDetails
+			}{packageID: packageID, details: details}
+		}(packageID)
+	}
+
+	for i := 0; i < len(packageIDs); i++ {
+		select {
+		case r := <-detailsChannel:
+			packageReleases, packageDeletes := feed.diffVersions(r.packageID, r.details, cutoff)
+			releases = append(releases, packageReleases...)
+			deletes = append(deletes, packageDeletes...)
+		case err := <-errChannel:
+			errs = append(errs, err)
+		}
+	}
+	return releases, deletes, errs
+}
+
+// Latest will parse all creation and deletion events for packages in the nuget.org
+// catalog feed since the cursor, or the cutoff if the feed does not have a cursor.
+// Following the catalog cursor semantics, commits are processed strictly in order
+// and the cursor is only advanced past a commit once all of its leaves have been
+// fetched. Packages are created at the time of their commit and the returned
+// cutoff is the new cursor. When polling specific packages, their versions are
+// instead fetched from the registration resource, and versions which were removed
+// since the previous poll are returned as deletions.
 // https://docs.microsoft.com/en-us/nuget/api/catalog-resource
-func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+func (feed *Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	if feed.packages != nil {
+		releases, deletes, errs := feed.fetchCriticalPackages(ctx, *feed.packages, cutoff)
+		if len(errs) == len(*feed.packages) && len(errs) != 0 {
+			// If none of the packages were successfully polled for, return early.
+			return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
+		}
+		// Deletes are created at the time they were detected, so only releases move
+		// the cutoff.
+		return append(releases, deletes...), feeds.FindCutoff(cutoff, releases), errs
+	}
+
 	pkgs := []*feeds.Package{}
 	var errs []error
 
-	catalogService, err := fetchCatalogService(feed.baseURL)
+	cursor := cutoff
+	if c := feed.Cursor(); c != "" {
+		var err error
+		cursor, err = time.Parse(time.RFC3339Nano, c)
+		if err != nil {
+			return nil, cutoff, append(errs, err)
+		}
+	}
+
+	catalogURL, err := feed.service(ctx, catalogServiceType)
 	if err != nil {
 		return nil, cutoff, append(errs, err)
 	}
 
-	catalogPages, err := fetchCatalogPages(catalogService.URI)
+	catalogPages, err := fetchCatalogPages(ctx, catalogURL)
 	if err != nil {
 		return nil, cutoff, append(errs, err)
 	}
 
+	sort.SliceStable(catalogPages, func(i, j int) bool {
+		return catalogPages[i].Created.Before(catalogPages[j].Created)
+	})
+	numPages := 0
 	for _, catalogPage := range catalogPages {
-		if catalogPage.Created.Before(cutoff) {
+		if !catalogPage.Created.After(cursor) {
 			continue
 		}
+		if numPages == maxCatalogPages {
+			break
+		}
+		numPages++
 
-		page, err := fetchCatalogPage(catalogPage.URI)
+		page, err := fetchCatalogPage(ctx, catalogPage.URI)
 		if err != nil {
 			errs = append(errs, err)
-			continue
+			break
 		}
 
-		for _, catalogLeafNode := range page {
-			if catalogLeafNode.CatalogCreated.Before(cutoff) {
-				continue
+		leaves := leavesAfter(page, cursor)
+		details, leafErrs := fetchLeaves(ctx, leaves)
+		var failedCommit time.Time
+		for i, leaf := range leaves {
+			if leafErrs[i] != nil {
+				errs = append(errs, leafErrs[i])
+				if failedCommit.IsZero() {
+					failedCommit = leaf.CatalogCreated
+				}
 			}
+		}
 
-			if catalogLeafNode.Type != "nuget:PackageDetails" {
-				continue // Not currently interested in package deletion events
+		for i, leaf := range leaves {
+			if !failedCommit.IsZero() && !leaf.CatalogCreated.Before(failedCommit) {
+				// The leaves of this and later commits are fetched again by the next call.
+				break
 			}
-
-			pkgInfo, err := fetchPackageInfo(catalogLeafNode.URI)
-			if err != nil {
-				errs = append(errs, err)
+			cursor = leaf.CatalogCreated
+			if leaf.Type == "nuget:PackageDelete" {
+				pkg := feeds.NewPackageEvent(leaf.CatalogCreated, leaf.PackageID, leaf.Version, feeds.DeleteEvent, FeedName)
+				pkgs = append(pkgs, pkg)
 				continue
 			}
-
-			pkg := feeds.NewPackage(pkgInfo.Created, pkgInfo.PackageID, pkgInfo.Version, FeedName)
+			if details[i] == nil {
+				continue
+			}
+			if details[i].Created.Before(leaf.CatalogCreated.Add(-maxPublishDelay)) {
+				// Not currently interested in package edit events.
+				log.WithFields(log.Fields{
+					"feed":    feed.options.InstanceName(FeedName),
+					"package": details[i].PackageID,
+					"version": details[i].Version,
+				}).Debug("Skipping nuget catalog leaf committed long after its version was published")
+				editsSkipped.WithLabelValues(feed.options.InstanceName(FeedName)).Inc()
+				continue
+			}
+			// Packages are created at the commit time of their leaf, the clock of the
+			// cursor, so that they are not filtered out by the cutoff returned by a
+			// previous call.
+			pkg := feeds.NewPackage(leaf.CatalogCreated, details[i].PackageID, details[i].Version, FeedName)
 			pkgs = append(pkgs, pkg)
 		}
+		if !failedCommit.IsZero() {
+			break
+		}
+		// The page is complete, its commit timestamp is that of its newest commit.
+		cursor = catalogPage.Created
+	}
+
+	feed.SetCursor(cursor.Format(time.RFC3339Nano))
+	return pkgs, cursor, errs
+}
+
+// Cursor returns the commit timestamp of the catalog up to which all leaves have
+// been fetched. When the packages option is set, it instead returns the versions
+// of each package listed by the previous poll, so that deletes made while the
+// feed is stopped are detected after a restart.
+func (feed *Feed) Cursor() string {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	if feed.packages == nil {
+		return feed.cursor
+	}
+	known := map[string][]string{}
+	for packageID, versions := range feed.known {
+		known[packageID] = sortedKeys(versions)
+	}
+	b, err := json.Marshal(known)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode nuget cursor")
+		return ""
 	}
-	newCutoff := feeds.FindCutoff(cutoff, pkgs)
-	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
+	return string(b)
+}
+
+// SetCursor restores the cursor of a previous poll. When the packages option is
+// set, a cursor which cannot be decoded is ignored, so that each package is
+// polled as if it was not seen before.
+func (feed *Feed) SetCursor(cursor string) {
+	if feed.packages == nil {
+		feed.mu.Lock()
+		defer feed.mu.Unlock()
+		feed.cursor = cursor
+		return
+	}
+	if cursor == "" {
+		return
+	}
+	known := map[string][]string{}
+	if err := json.Unmarshal([]byte(cursor), &known); err != nil {
+		log.WithError(err).Warn("Ignoring invalid nuget cursor")
+		return
+	}
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.known = map[string]map[string]bool{}
+	for packageID, versions := range known {
+		feed.known[packageID] = map[string]bool{}
+		for _, v := range versions {
+			feed.known[packageID][v] = true
+		}
+	}
+}
 
-	return pkgs, newCutoff, errs
+// SupportsBackfill returns true, as the catalog contains every package since its creation.
+func (feed *Feed) SupportsBackfill() bool {
+	return true
 }
 
-func (feed Feed) GetName() string {
+func (feed *Feed) GetName() string {
 	return FeedName
 }
 
-func (feed Feed) GetFeedOptions() feeds.FeedOptions {
+func (feed *Feed) GetFeedOptions() feeds.FeedOptions {
 	return feed.options
 }
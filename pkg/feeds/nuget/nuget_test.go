@@ -1,12 +1,20 @@
 package nuget
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ossf/package-feeds/pkg/backfill"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	testutils "github.com/ossf/package-feeds/pkg/utils/test"
 )
@@ -39,7 +47,7 @@ func TestCanParseFeed(t *testing.T) {
 
 	cutoff := time.Now().Add(-5 * time.Minute)
 
-	results, gotCutoff, errs := sut.Latest(cutoff)
+	results, gotCutoff, errs := sut.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatal(errs[len(errs)-1])
 	}
@@ -52,8 +60,14 @@ func TestCanParseFeed(t *testing.T) {
 		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
 	}
 
-	if len(results) != 1 {
-		t.Fatalf("1 result expected but %d retrieved", len(results))
+	if len(results) != 2 {
+		t.Fatalf("2 results expected but %d retrieved", len(results))
+	}
+
+	// Deleted packages are returned as delete events.
+	deleted := results[1]
+	if deleted.Name != "deleted.expected.package" || deleted.Version != "0.0.1" || deleted.Event != feeds.DeleteEvent {
+		t.Errorf("expected delete event for deleted.expected.package 0.0.1 but %+v was retrieved", deleted)
 	}
 
 	const expectedName = "new.expected.package"
@@ -74,6 +88,332 @@ func TestCanParseFeed(t *testing.T) {
 	}
 }
 
+func TestLatestPagesCatalog(t *testing.T) {
+	t.Parallel()
+
+	cutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	pageCreated := func(i int) time.Time {
+		return cutoff.Add(time.Duration(i+1) * time.Hour)
+	}
+	var fetched sync.Map
+	var srv *httptest.Server
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath: func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"resources": [{"@id": "%s/catalog.json", "@type": "Catalog/3.0.0"}]}`, srv.URL)
+		},
+		"/catalog.json": func(w http.ResponseWriter, _ *http.Request) {
+			// Pages are listed newest first to ensure they are fetched in commit order.
+			items := []string{}
+			for i := maxCatalogPages; i >= 0; i-- {
+				items = append(items, fmt.Sprintf(`{"@id": "%s/pages/%d.json", "commitTimeStamp": "%s"}`,
+					srv.URL, i, pageCreated(i).Format(time.RFC3339)))
+			}
+			fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+		},
+		"/pages/": func(w http.ResponseWriter, r *http.Request) {
+			fetched.Store(r.URL.Path, true)
+			fmt.Fprint(w, `{"items": []}`)
+		},
+	}
+	srv = testutils.HTTPServerMock(handlers)
+	defer srv.Close()
+
+	sut, err := New(feeds.FeedOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create nuget feed: %v", err)
+	}
+	sut.baseURL = srv.URL
+
+	_, gotCutoff, errs := sut.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatal(errs[len(errs)-1])
+	}
+	if want := pageCreated(maxCatalogPages - 1); !gotCutoff.Equal(want) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, want)
+	}
+	if _, ok := fetched.Load(fmt.Sprintf("/pages/%d.json", maxCatalogPages)); ok {
+		t.Errorf("Latest() fetched more than %d catalog pages", maxCatalogPages)
+	}
+	if _, ok := fetched.Load("/pages/0.json"); !ok {
+		t.Errorf("Latest() did not fetch the oldest catalog page")
+	}
+}
+
+func TestLatestFollowsCursor(t *testing.T) {
+	t.Parallel()
+
+	cursor := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	commit := func(i int) time.Time {
+		return cursor.Add(time.Duration(i) * time.Minute)
+	}
+	var failing atomic.Bool
+	failing.Store(true)
+	var srv *httptest.Server
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath: func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"resources": [{"@id": "%s/catalog.json", "@type": "Catalog/3.0.0"}]}`, srv.URL)
+		},
+		"/catalog.json": func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"items": [{"@id": "%s/page.json", "commitTimeStamp": "%s"}]}`,
+				srv.URL, commit(4).Format(time.RFC3339))
+		},
+		"/page.json": func(w http.ResponseWriter, _ *http.Request) {
+			// Leaves are listed out of commit order. The leaf committed at minute 4 is
+			// an edit of a version published long before.
+			items := []string{}
+			for _, i := range []int{3, 1, 2, 4, 0} {
+				items = append(items, fmt.Sprintf(`{"@id": "%s/leaves/%d.json", "@type": "nuget:PackageDetails",
+					"commitTimeStamp": "%s"}`, srv.URL, i, commit(i).Format(time.RFC3339)))
+			}
+			fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+		},
+		"/leaves/": func(w http.ResponseWriter, r *http.Request) {
+			var i int
+			if _, err := fmt.Sscanf(r.URL.Path, "/leaves/%d.json", &i); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if i == 2 && failing.Load() {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			published := commit(i)
+			if i == 4 {
+				published = published.Add(-30 * 24 * time.Hour)
+			}
+			fmt.Fprintf(w, `{"id": "package%d", "version": "1.0.0", "published": "%s"}`,
+				i, published.Format(time.RFC3339))
+		},
+	}
+	srv = testutils.HTTPServerMock(handlers)
+	defer srv.Close()
+
+	sut, err := New(feeds.FeedOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create nuget feed: %v", err)
+	}
+	sut.baseURL = srv.URL
+	sut.SetCursor(cursor.Format(time.RFC3339Nano))
+	skipped := testutil.ToFloat64(editsSkipped.WithLabelValues(FeedName))
+
+	// The cursor stops before the commit of the leaf which failed to be fetched.
+	pkgs, gotCutoff, errs := sut.Latest(context.Background(), time.Time{})
+	if len(errs) != 1 {
+		t.Fatalf("Latest() returned errors %v, want 1", errs)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "package1" {
+		t.Errorf("Latest() returned %v, want package1", pkgs)
+	}
+	if !gotCutoff.Equal(commit(1)) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, commit(1))
+	}
+	if want := commit(1).Format(time.RFC3339Nano); sut.Cursor() != want {
+		t.Errorf("Cursor() = %v, want %v", sut.Cursor(), want)
+	}
+
+	// The remaining commits are processed by the next call.
+	failing.Store(false)
+	pkgs, gotCutoff, errs = sut.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 {
+		t.Fatal(errs[len(errs)-1])
+	}
+	if len(pkgs) != 2 || pkgs[0].Name != "package2" || pkgs[1].Name != "package3" {
+		t.Errorf("Latest() returned %v, want package2 and package3", pkgs)
+	}
+	if !gotCutoff.Equal(commit(4)) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, commit(4))
+	}
+	if got := testutil.ToFloat64(editsSkipped.WithLabelValues(FeedName)) - skipped; got != 1 {
+		t.Errorf("Latest() counted %v skipped edits, want 1", got)
+	}
+}
+
+type countingPublisher struct {
+	sent *atomic.Int32
+}
+
+func (pub countingPublisher) Send(_ context.Context, _ []byte) error {
+	pub.sent.Add(1)
+	return nil
+}
+
+func (pub countingPublisher) Name() string {
+	return "counting"
+}
+
+func (pub countingPublisher) Close(_ context.Context) error {
+	return nil
+}
+
+func TestBackfillAcrossCatalogPages(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	pageCreated := func(i int) time.Time {
+		return since.Add(time.Duration(i+1) * time.Hour)
+	}
+	var srv *httptest.Server
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath: func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"resources": [{"@id": "%s/catalog.json", "@type": "Catalog/3.0.0"}]}`, srv.URL)
+		},
+		"/catalog.json": func(w http.ResponseWriter, _ *http.Request) {
+			items := []string{}
+			for i := 0; i <= maxCatalogPages; i++ {
+				items = append(items, fmt.Sprintf(`{"@id": "%s/pages/%d.json", "commitTimeStamp": "%s"}`,
+					srv.URL, i, pageCreated(i).Format(time.RFC3339)))
+			}
+			fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+		},
+		"/pages/": func(w http.ResponseWriter, r *http.Request) {
+			var i int
+			if _, err := fmt.Sscanf(r.URL.Path, "/pages/%d.json", &i); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"items": [{"@id": "%s/leaves/%d.json", "@type": "nuget:PackageDetails",
+				"commitTimeStamp": "%s"}]}`, srv.URL, i, pageCreated(i).Format(time.RFC3339))
+		},
+		"/leaves/": func(w http.ResponseWriter, r *http.Request) {
+			var i int
+			if _, err := fmt.Sscanf(r.URL.Path, "/leaves/%d.json", &i); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// Each version is published before the commit of the previous page.
+			published := pageCreated(i).Add(-90 * time.Minute)
+			fmt.Fprintf(w, `{"id": "package%d", "version": "1.0.0", "published": "%s"}`,
+				i, published.Format(time.RFC3339))
+		},
+	}
+	srv = testutils.HTTPServerMock(handlers)
+	defer srv.Close()
+
+	sut, err := New(feeds.FeedOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create nuget feed: %v", err)
+	}
+	sut.baseURL = srv.URL
+
+	// The window is backfilled by two calls to Latest, the second starting from
+	// the commit of the last page fetched by the first.
+	var sent atomic.Int32
+	until := pageCreated(maxCatalogPages)
+	result := backfill.Run(context.Background(), FeedName, sut, countingPublisher{sent: &sent}, since, until)
+	if !result.Complete(until) {
+		t.Errorf("backfill.Run() covered %v with errors %v, want the window to be complete", result.Covered, result.Errs)
+	}
+	if want := maxCatalogPages + 1; result.NumPublished != want || int(sent.Load()) != want {
+		t.Errorf("backfill.Run() published %d packages, want %d", sent.Load(), want)
+	}
+}
+
+func TestLatestCriticalPackages(t *testing.T) {
+	t.Parallel()
+
+	cutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	leaf := func(version string, published time.Time) string {
+		return fmt.Sprintf(`{"catalogEntry": {"id": "Foo.Package", "version": "%s", "published": "%s"}}`,
+			version, published.Format(time.RFC3339))
+	}
+	var srv *httptest.Server
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath: func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"resources": [{"@id": "%s/registration/", "@type": "RegistrationsBaseUrl"},
+				{"@id": "%s/registration-semver2/", "@type": "RegistrationsBaseUrl/3.6.0"}]}`, srv.URL, srv.URL)
+		},
+		// The first page is inlined in the index, the second must be fetched.
+		"/registration-semver2/foo.package/index.json": func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"items": [{"@id": "%s/page0.json", "items": [%s]}, {"@id": "%s/page1.json"}]}`,
+				srv.URL, leaf("1.0.0", cutoff.Add(-time.Hour)), srv.URL)
+		},
+		"/page1.json": func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"items": [%s, %s]}`,
+				leaf("1.1.0", cutoff.Add(time.Hour)), leaf("2.0.0-beta+1", cutoff.Add(2*time.Hour)))
+		},
+	}
+	srv = testutils.HTTPServerMock(handlers)
+	defer srv.Close()
+
+	sut, err := New(feeds.FeedOptions{Packages: &[]string{"Foo.Package"}})
+	if err != nil {
+		t.Fatalf("Failed to create nuget feed: %v", err)
+	}
+	sut.baseURL = srv.URL
+
+	pkgs, gotCutoff, errs := sut.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatal(errs[len(errs)-1])
+	}
+	if len(pkgs) != 2 || pkgs[0].Version != "1.1.0" || pkgs[1].Version != "2.0.0-beta+1" {
+		t.Errorf("Latest() returned %v, want versions 1.1.0 and 2.0.0-beta+1", pkgs)
+	}
+	if want := cutoff.Add(2 * time.Hour); !gotCutoff.Equal(want) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, want)
+	}
+}
+
+func TestLatestCriticalPackagesDeletes(t *testing.T) {
+	t.Parallel()
+
+	cutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	leaf := func(version string, published time.Time) string {
+		return fmt.Sprintf(`{"catalogEntry": {"id": "Foo.Package", "version": "%s", "published": "%s"}}`,
+			version, published.Format(time.RFC3339))
+	}
+	var deleted atomic.Bool
+	var srv *httptest.Server
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		indexPath: func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintf(w, `{"resources": [{"@id": "%s/registration/", "@type": "RegistrationsBaseUrl/3.6.0"}]}`, srv.URL)
+		},
+		"/registration/foo.package/index.json": func(w http.ResponseWriter, _ *http.Request) {
+			leaves := []string{leaf("1.0.0", cutoff.Add(-time.Hour))}
+			if !deleted.Load() {
+				leaves = append(leaves, leaf("1.1.0", cutoff.Add(time.Hour)))
+			}
+			fmt.Fprintf(w, `{"items": [{"@id": "%s/page0.json", "items": [%s]}]}`, srv.URL, strings.Join(leaves, ","))
+		},
+	}
+	srv = testutils.HTTPServerMock(handlers)
+	defer srv.Close()
+
+	packages := []string{"Foo.Package"}
+	newFeed := func() *Feed {
+		sut, err := New(feeds.FeedOptions{Packages: &packages})
+		if err != nil {
+			t.Fatalf("Failed to create nuget feed: %v", err)
+		}
+		sut.baseURL = srv.URL
+		return sut
+	}
+
+	sut := newFeed()
+	pkgs, gotCutoff, errs := sut.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatal(errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "1.1.0" {
+		t.Fatalf("Latest() returned %v, want version 1.1.0", pkgs)
+	}
+	cursor := sut.Cursor()
+
+	// A feed restored from the cursor detects the delete made while it was stopped.
+	deleted.Store(true)
+	restarted := newFeed()
+	restarted.SetCursor(cursor)
+	pkgs, newCutoff, errs := restarted.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 {
+		t.Fatal(errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "1.1.0" || pkgs[0].Event != feeds.DeleteEvent {
+		t.Fatalf("Latest() returned %v, want a delete of 1.1.0", pkgs)
+	}
+	if !newCutoff.Equal(gotCutoff) {
+		t.Errorf("Latest() cutoff %v, want the delete not to move the cutoff from %v", newCutoff, gotCutoff)
+	}
+}
+
 func indexMock(w http.ResponseWriter, _ *http.Request) {
 	var err error
 	catalogEndpoint, err := makeTestURL("v3/catalog0/index.json")
@@ -128,14 +468,15 @@ func catalogPageMock(w http.ResponseWriter, _ *http.Request) {
 		oldAddedItemURL,
 		pkgAdded, time.Now().UTC().Add(-10*time.Minute).Format(time.RFC3339))
 
-	deletedItemURL, err := makeTestURL("v3/catalog0/data/somecatalog/modified.not.expected.0.0.1.json")
+	deletedItemURL, err := makeTestURL("v3/catalog0/data/somecatalog/deleted.expected.package.0.0.1.json")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	deletedItem := fmt.Sprintf(pkgTemplate,
+	deletedItem := fmt.Sprintf(`{"@id": "%s", "@type": "%s", "commitTimeStamp": "%s",
+		"nuget:id": "deleted.expected.package", "nuget:version": "0.0.1"}`,
 		deletedItemURL,
-		pkgDeleted, time.Now().UTC().Format(time.RFC3339))
+		pkgDeleted, time.Now().UTC().Add(time.Second).Format(time.RFC3339))
 
 	response := fmt.Sprintf(`{"items": [%s, %s, %s]}`, addedItem, deletedItem, oldAddedItem)
 
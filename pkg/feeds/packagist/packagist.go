@@ -1,19 +1,31 @@
 package packagist
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
+
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/useragent"
 	"github.com/ossf/package-feeds/pkg/utils"
 )
 
-const FeedName = "packagist"
+const (
+	FeedName = "packagist"
+
+	// metadataCacheLimit defines how many packages have their metadata
+	// remembered, so that unchanged metadata is not downloaded again.
+	metadataCacheLimit = 10000
+)
+
+var errResyncRequired = errors.New("packagist changes are no longer available since cutoff")
 
 var httpClient = &http.Client{
 	Transport: &useragent.RoundTripper{UserAgent: feeds.DefaultUserAgent},
@@ -31,32 +43,55 @@ type actions struct {
 	Time    int64  `json:"time"`
 }
 
+// metadataEntry records the metadata of a package fetched by a previous poll.
+type metadataEntry struct {
+	lastModified string
+	versions     map[string]bool
+}
+
 type Feed struct {
 	updateHost  string
 	versionHost string
+	packages    *[]string
 	options     feeds.FeedOptions
+
+	// metadata records the versions listed by the metadata of each package,
+	// keyed by the name of the metadata file.
+	metadata *lru.Cache[string, *metadataEntry]
 }
 
 func New(feedOptions feeds.FeedOptions) (*Feed, error) {
-	if feedOptions.Packages != nil {
+	if feedOptions.Packages == nil && feedOptions.URL != "" {
+		// Repositories such as Satis do not serve the changes API, so a repository
+		// can only be configured when polling specific packages.
 		return nil, feeds.UnsupportedOptionError{
 			Feed:   FeedName,
-			Option: "packages",
+			Option: "url",
 		}
 	}
-	return &Feed{
+	metadata, err := lru.New[string, *metadataEntry](metadataCacheLimit)
+	if err != nil {
+		return nil, err
+	}
+	feed := &Feed{
 		updateHost:  "https://packagist.org",
 		versionHost: "https://repo.packagist.org",
+		packages:    feedOptions.Packages,
 		options:     feedOptions,
-	}, nil
+		metadata:    metadata,
+	}
+	if feedOptions.URL != "" {
+		feed.versionHost = feedOptions.URL
+	}
+	return feed, nil
 }
 
-func fetchPackages(updateHost string, since time.Time) ([]actions, error) {
+func fetchPackages(ctx context.Context, updateHost string, since time.Time) ([]actions, error) {
 	pkgURL, err := url.JoinPath(updateHost, "/metadata/changes.json")
 	if err != nil {
 		return nil, err
 	}
-	request, err := http.NewRequest(http.MethodGet, pkgURL, nil)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, pkgURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -84,13 +119,29 @@ func fetchPackages(updateHost string, since time.Time) ([]actions, error) {
 	return apiResponse.Actions, nil
 }
 
-func fetchVersionInformation(versionHost string, action actions) ([]*feeds.Package, error) {
-	resp, err := httpClient.Get(fmt.Sprintf("%s/p2/%s.json", versionHost, action.Package))
+// fetchVersionInformation returns the versions listed by a package's metadata
+// which were not listed when the metadata was previously fetched. The first time
+// the metadata is fetched, the versions released after the cutoff are returned.
+// If-Modified-Since is used so that unchanged metadata is not downloaded again.
+func (f Feed) fetchVersionInformation(ctx context.Context, name string, cutoff time.Time) ([]*feeds.Package, error) {
+	versionURL := fmt.Sprintf("%s/p2/%s.json", f.versionHost, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, versionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	prev, seen := f.metadata.Get(name)
+	if seen && prev.lastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.lastModified)
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return []*feeds.Package{}, nil
+	}
 	err = utils.CheckResponseStatus(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch packagist package version data: %w", err)
@@ -102,45 +153,113 @@ func fetchVersionInformation(versionHost string, action actions) ([]*feeds.Packa
 		return nil, err
 	}
 
+	entry := &metadataEntry{
+		lastModified: resp.Header.Get("Last-Modified"),
+		versions:     map[string]bool{},
+	}
 	pkgs := []*feeds.Package{}
 	for pkgName, versions := range versionResponse.Packages {
+		var created time.Time
+		var shasum string
 		for _, version := range versions {
-			pkg := feeds.NewPackage(version.Time, pkgName, version.Version, FeedName)
-			if err != nil {
+			// Minified metadata omits the fields of a version which are unchanged
+			// from the previous version.
+			if !version.Time.IsZero() {
+				created = version.Time
+			}
+			if version.Dist != nil {
+				shasum = version.Dist.Shasum
+			}
+			entry.versions[version.Version] = true
+			if (seen && prev.versions[version.Version]) || (!seen && !created.After(cutoff)) {
 				continue
 			}
+			pkg := feeds.NewPackage(created, pkgName, version.Version, FeedName)
+			if shasum != "" {
+				pkg.Checksum = "sha1:" + shasum
+			}
 			pkgs = append(pkgs, pkg)
 		}
 	}
+	f.metadata.Add(name, entry)
 
 	return pkgs, nil
 }
 
+// fetchCriticalPackages returns the new releases of each of the given packages,
+// fetching the packages concurrently.
+func (f Feed) fetchCriticalPackages(ctx context.Context, names []string, cutoff time.Time) ([]*feeds.Package, []error) {
+	pkgs := []*feeds.Package{}
+	errs := []error{}
+	packageChannel := make(chan []*feeds.Package)
+	errChannel := make(chan error)
+
+	for _, name := range names {
+		go func(name string) {
+			updates, err := f.fetchVersionInformation(ctx, name, cutoff)
+			if err != nil {
+				errChannel <- feeds.PackagePollError{Name: name, Err: err}
+				return
+			}
+			packageChannel <- updates
+		}(name)
+	}
+
+	for i := 0; i < len(names); i++ {
+		select {
+		case updates := <-packageChannel:
+			pkgs = append(pkgs, updates...)
+		case err := <-errChannel:
+			errs = append(errs, err)
+		}
+	}
+	return pkgs, errs
+}
+
 // Latest returns all package updates of packagist packages since cutoff.
-func (f Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+func (f Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	if f.packages != nil {
+		pkgs, errs := f.fetchCriticalPackages(ctx, *f.packages, cutoff)
+		if len(errs) == len(*f.packages) && len(errs) != 0 {
+			// If none of the packages were successfully polled for, return early.
+			return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
+		}
+		return pkgs, feeds.FindCutoff(cutoff, pkgs), errs
+	}
+
 	pkgs := []*feeds.Package{}
 	var errs []error
-	packages, err := fetchPackages(f.updateHost, cutoff)
+	packages, err := fetchPackages(ctx, f.updateHost, cutoff)
 	if err != nil {
 		return nil, cutoff, append(errs, err)
 	}
 	for _, pkg := range packages {
+		if pkg.Type == "resync" {
+			// Changes older than the retention period of packagist are replaced by a
+			// single resync action.
+			return nil, cutoff, append(errs, errResyncRequired)
+		}
 		if time.Unix(pkg.Time, 0).Before(cutoff) {
 			continue
 		}
 		if pkg.Type == "delete" {
 			continue
 		}
-		updates, err := fetchVersionInformation(f.versionHost, pkg)
+		updates, err := f.fetchVersionInformation(ctx, pkg.Package, cutoff)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("error in fetching version information: %w", err))
 			continue
 		}
 		pkgs = append(pkgs, updates...)
 	}
-	newCutoff := feeds.FindCutoff(cutoff, pkgs)
-	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
-	return pkgs, newCutoff, errs
+	return pkgs, feeds.FindCutoff(cutoff, pkgs), errs
+}
+
+// SupportsBackfill returns true when polling specific packages, as their metadata
+// lists every version. Packagist only retains changes for a limited period, so
+// polling all packages from older cutoffs returns errResyncRequired.
+func (f Feed) SupportsBackfill() bool {
+	return f.packages != nil
 }
 
 func (f Feed) GetName() string {
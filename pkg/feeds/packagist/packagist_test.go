@@ -1,8 +1,10 @@
 package packagist
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -29,7 +31,7 @@ func TestFetch(t *testing.T) {
 	feed.versionHost = srv.URL
 
 	cutoff := time.Unix(1614513658, 0)
-	latest, gotCutoff, errs := feed.Latest(cutoff)
+	latest, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("got error: %v", errs[len(errs)-1])
 	}
@@ -70,7 +72,7 @@ func TestPackagistNotFound(t *testing.T) {
 	feed.versionHost = srv.URL
 
 	cutoff := time.Unix(1614513658, 0)
-	_, gotCutoff, errs := feed.Latest(cutoff)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if cutoff != gotCutoff {
 		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
 	}
@@ -82,6 +84,171 @@ func TestPackagistNotFound(t *testing.T) {
 	}
 }
 
+func TestPackagistResync(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/metadata/changes.json": resyncMock,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	defer srv.Close()
+	feed, err := New(feeds.FeedOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create packagist feed: %v", err)
+	}
+	feed.updateHost = srv.URL
+	feed.versionHost = srv.URL
+
+	cutoff := time.Unix(1614513658, 0)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if cutoff != gotCutoff {
+		t.Error("feed.Latest() cutoff should be unchanged if a resync is required")
+	}
+	if len(pkgs) != 0 {
+		t.Errorf("feed.Latest() returned %v packages when 0 were expected", len(pkgs))
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], errResyncRequired) {
+		t.Fatalf("feed.Latest() returned errors %v, want [%v]", errs, errResyncRequired)
+	}
+}
+
+func TestPackagistSupportsBackfill(t *testing.T) {
+	t.Parallel()
+
+	feed, err := New(feeds.FeedOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create packagist feed: %v", err)
+	}
+	if feed.SupportsBackfill() {
+		t.Error("SupportsBackfill() = true without the packages option, want false")
+	}
+	feed, err = New(feeds.FeedOptions{Packages: &[]string{"foo/bar"}})
+	if err != nil {
+		t.Fatalf("Failed to create packagist feed: %v", err)
+	}
+	if !feed.SupportsBackfill() {
+		t.Error("SupportsBackfill() = false with the packages option, want true")
+	}
+}
+
+func TestPackagistURLRequiresPackages(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(feeds.FeedOptions{URL: "https://satis.example.com"})
+	if !errors.As(err, &feeds.UnsupportedOptionError{}) {
+		t.Errorf("New returned %v, want an unsupported option error", err)
+	}
+}
+
+func TestPackagistCriticalPackages(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/p2/ossf/package.json": func(w http.ResponseWriter, r *http.Request) {
+			const lastModified = "Sun, 28 Feb 2021 12:20:03 GMT"
+			switch polls.Add(1) {
+			case 1:
+				w.Header().Set("Last-Modified", lastModified)
+				_, err := w.Write([]byte(`{"packages":{"ossf/package":[
+					{"name":"ossf/package","version":"v1.0.0","time":"2021-02-28T12:20:03+00:00",
+					"dist":{"type":"zip","shasum":"da39a3ee5e6b4b0d3255bfef95601890afd80709"}},
+					{"version":"v0.9.0","time":"2021-01-01T00:00:00+00:00"}]},"minified":"composer/2.0"}`))
+				if err != nil {
+					http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+				}
+			case 2:
+				if r.Header.Get("If-Modified-Since") != lastModified {
+					t.Errorf("If-Modified-Since = %q, want %q", r.Header.Get("If-Modified-Since"), lastModified)
+				}
+				w.WriteHeader(http.StatusNotModified)
+			default:
+				// A version tagged from an older commit is released.
+				_, err := w.Write([]byte(`{"packages":{"ossf/package":[
+					{"name":"ossf/package","version":"v1.0.0","time":"2021-02-28T12:20:03+00:00"},
+					{"version":"v0.9.1"},
+					{"version":"v0.9.0","time":"2021-01-01T00:00:00+00:00"}]},"minified":"composer/2.0"}`))
+				if err != nil {
+					http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+				}
+			}
+		},
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	defer srv.Close()
+	packages := []string{"ossf/package"}
+	feed, err := New(feeds.FeedOptions{Packages: &packages, URL: srv.URL})
+	if err != nil {
+		t.Fatalf("Failed to create packagist feed: %v", err)
+	}
+
+	cutoff := time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("got error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "v1.0.0" {
+		t.Fatalf("Latest() returned %v, want only version v1.0.0", pkgs)
+	}
+	if pkgs[0].Checksum != "sha1:da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+		t.Errorf("Latest() checksum %q, want the sha1 of the dist", pkgs[0].Checksum)
+	}
+
+	pkgs, gotCutoff, errs = feed.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 || len(pkgs) != 0 {
+		t.Fatalf("Latest() returned %v, %v when the metadata was not modified", pkgs, errs)
+	}
+
+	// Versions are compared with the previous poll, so the new version is
+	// returned although it was created before the cutoff.
+	pkgs, _, errs = feed.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 {
+		t.Fatalf("got error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "v0.9.1" {
+		t.Fatalf("Latest() returned %v, want only version v0.9.1", pkgs)
+	}
+	wantCreated := time.Date(2021, 2, 28, 12, 20, 3, 0, time.UTC)
+	if !pkgs[0].CreatedDate.Equal(wantCreated) {
+		t.Errorf("Latest() created %v, want %v from the minified metadata", pkgs[0].CreatedDate, wantCreated)
+	}
+}
+
+func TestPackagistCriticalPackagesNotFound(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/p2/": testutils.NotFoundHandlerFunc,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	defer srv.Close()
+	packages := []string{"ossf/package"}
+	feed, err := New(feeds.FeedOptions{Packages: &packages, URL: srv.URL})
+	if err != nil {
+		t.Fatalf("Failed to create packagist feed: %v", err)
+	}
+
+	cutoff := time.Unix(1614513658, 0)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if cutoff != gotCutoff {
+		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
+	}
+	if !errors.Is(errs[len(errs)-1], feeds.ErrNoPackagesPolled) {
+		t.Fatalf("feed.Latest() returned an error which did not match the expected error")
+	}
+}
+
+func resyncMock(w http.ResponseWriter, _ *http.Request) {
+	_, err := w.Write([]byte(`{"actions":[{"type":"resync","package":"*","time":1614514502}],
+	"timestamp":16145145025048}`))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
 func changesMock(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Query().Get("since") == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -8,6 +8,11 @@ type versionInfo struct {
 	License           []string  `json:"license,omitempty"`
 	Time              time.Time `json:"time"`
 	Name              string    `json:"name,omitempty"`
+	Dist              *dist     `json:"dist,omitempty"`
+}
+
+type dist struct {
+	Shasum string `json:"shasum"`
 }
 
 type packages struct {
@@ -0,0 +1,177 @@
+package pypi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+const projectPathFormat = "/pypi/%s/json"
+
+// Project is the response of the PyPI JSON API for a project, described by
+// https://warehouse.pypa.io/api-reference/json.html#project
+type Project struct {
+	Info struct {
+		Name string `json:"name"`
+	} `json:"info"`
+	Releases map[string][]*File `json:"releases"`
+}
+
+// File is a distribution file uploaded to a release of a project.
+type File struct {
+	Filename string `json:"filename"`
+	Digests  struct {
+		SHA256 string `json:"sha256"`
+	} `json:"digests"`
+	RequiresPython string    `json:"requires_python"`
+	UploadTime     time.Time `json:"upload_time_iso_8601"`
+	// Yanked is set for files which have been yanked, as defined by PEP 592.
+	Yanked bool `json:"yanked"`
+
+	version string
+}
+
+// files returns the files of every release of the project in the order they
+// were uploaded.
+func (p *Project) files() []*File {
+	files := []*File{}
+	for version, releaseFiles := range p.Releases {
+		for _, f := range releaseFiles {
+			f.version = version
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].UploadTime.Equal(files[j].UploadTime) {
+			return files[i].Filename < files[j].Filename
+		}
+		return files[i].UploadTime.Before(files[j].UploadTime)
+	})
+	return files
+}
+
+func fetchProject(ctx context.Context, baseURL, name string) (*Project, error) {
+	projectURL, err := url.JoinPath(baseURL, fmt.Sprintf(projectPathFormat, name))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, projectURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = utils.CheckResponseStatus(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pypi package data: %w", err)
+	}
+
+	project := &Project{}
+	if err := json.NewDecoder(resp.Body).Decode(project); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func newFilePackage(name string, f *File) *feeds.Package {
+	pkg := feeds.NewArtifact(f.UploadTime, name, f.version, f.Filename, FeedName)
+	if f.Digests.SHA256 != "" {
+		pkg.Checksum = "sha256:" + f.Digests.SHA256
+	}
+	pkg.RequiresPython = f.RequiresPython
+	return pkg
+}
+
+func newYankEvent(created time.Time, name string, f *File) *feeds.Package {
+	event := feeds.UnyankEvent
+	if f.Yanked {
+		event = feeds.YankEvent
+	}
+	pkg := feeds.NewPackageEvent(created, name, f.version, event, FeedName)
+	pkg.ArtifactID = f.Filename
+	return pkg
+}
+
+// diffFiles compares the files of a project with those seen by the previous
+// poll, returning the files which were uploaded since along with events for
+// files which were yanked or unyanked. The first time a project is polled, only
+// the files uploaded after the cutoff are returned.
+func (feed *Feed) diffFiles(project *Project, cutoff time.Time) ([]*feeds.Package, []*feeds.Package) {
+	name := normalizeName(project.Info.Name)
+
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	known, seen := feed.files[name]
+	current := map[string]bool{}
+
+	// The JSON API does not record when a file was yanked, so yanks are created
+	// at the time they were detected.
+	now := time.Now().UTC()
+	uploads := []*feeds.Package{}
+	yanks := []*feeds.Package{}
+	for _, f := range project.files() {
+		current[f.Filename] = f.Yanked
+		if yanked, ok := known[f.Filename]; ok {
+			if yanked != f.Yanked {
+				yanks = append(yanks, newYankEvent(now, name, f))
+			}
+			continue
+		}
+		if !seen && !f.UploadTime.After(cutoff) {
+			continue
+		}
+		uploads = append(uploads, newFilePackage(name, f))
+		if f.Yanked {
+			yanks = append(yanks, newYankEvent(now, name, f))
+		}
+	}
+	feed.files[name] = current
+	return uploads, yanks
+}
+
+// fetchCriticalPackages returns the files uploaded to each of the given projects
+// along with the files which were yanked or unyanked, fetching the projects
+// concurrently.
+func (feed *Feed) fetchCriticalPackages(
+	ctx context.Context, packageList []string, cutoff time.Time,
+) ([]*feeds.Package, []*feeds.Package, []error) {
+	projectChannel := make(chan *Project)
+	errChannel := make(chan error)
+
+	for _, pkgName := range packageList {
+		go func(pkgName string) {
+			project, err := fetchProject(ctx, feed.baseURL, pkgName)
+			if err != nil {
+				errChannel <- feeds.PackagePollError{Name: pkgName, Err: err}
+				return
+			}
+			projectChannel <- project
+		}(pkgName)
+	}
+
+	uploads := []*feeds.Package{}
+	yanks := []*feeds.Package{}
+	errs := []error{}
+	for i := 0; i < len(packageList); i++ {
+		select {
+		case project := <-projectChannel:
+			projectUploads, projectYanks := feed.diffFiles(project, cutoff)
+			uploads = append(uploads, projectUploads...)
+			yanks = append(yanks, projectYanks...)
+		case err := <-errChannel:
+			errs = append(errs, err)
+		}
+	}
+	return uploads, yanks, errs
+}
@@ -1,14 +1,20 @@
 package pypi
 
 import (
+	"context"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	log "github.com/sirupsen/logrus"
+
 	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/useragent"
@@ -16,9 +22,12 @@ import (
 )
 
 const (
-	FeedName          = "pypi"
-	updatesPath       = "/rss/updates.xml"
-	packagePathFormat = "/rss/project/%s/releases.xml"
+	FeedName        = "pypi"
+	updatesPath     = "/rss/updates.xml"
+	newProjectsPath = "/rss/packages.xml"
+
+	// newProjectTitleSuffix ends the title of each item of the new projects feed.
+	newProjectTitleSuffix = " added to PyPI"
 )
 
 var (
@@ -26,7 +35,12 @@ var (
 		Transport: &useragent.RoundTripper{UserAgent: feeds.DefaultUserAgent},
 		Timeout:   10 * time.Second,
 	}
-	errInvalidLinkForPackage = errors.New("invalid link provided by pypi API")
+	errInvalidEntry    = errors.New("unable to parse name and version of pypi entry")
+	errMismatchedEntry = errors.New("title and link of pypi entry do not match")
+
+	// validName matches valid project names as defined by
+	// https://packaging.python.org/en/latest/specifications/name-normalization/
+	validName = regexp.MustCompile(`^(?i)([A-Z0-9]|[A-Z0-9][A-Z0-9._-]*[A-Z0-9])$`)
 )
 
 type Response struct {
@@ -39,22 +53,88 @@ type Package struct {
 	Link        string      `xml:"link"`
 }
 
-func (p *Package) Name() (string, error) {
-	// The XML Link splits to: []string{"https:", "", "pypi.org", "project", "foopy", "2.1", ""}
-	parts := strings.Split(p.Link, "/")
-	if len(parts) < 5 {
-		return "", errInvalidLinkForPackage
+// NameVersion returns the normalized name and the version of a release listed by
+// the updates feed. Both the title, formatted as "{name} {version}", and the
+// link, formatted as "https://pypi.org/project/{name}/{version}/", are parsed so
+// that either can be used if the other cannot be parsed. An error is returned if
+// neither can be parsed or if they disagree, so that a release is never
+// attributed to the wrong project.
+func (p *Package) NameVersion() (string, string, error) {
+	titleName, titleVersion, titleOK := parseTitle(p.Title)
+	linkName, linkVersion, linkOK := parseLink(p.Link)
+	switch {
+	case titleOK && linkOK:
+		if normalizeName(titleName) != normalizeName(linkName) || titleVersion != linkVersion {
+			return "", "", fmt.Errorf("%w : title %q, link %q", errMismatchedEntry, p.Title, p.Link)
+		}
+		return normalizeName(linkName), linkVersion, nil
+	case linkOK:
+		return normalizeName(linkName), linkVersion, nil
+	case titleOK:
+		return normalizeName(titleName), titleVersion, nil
+	default:
+		return "", "", fmt.Errorf("%w : title %q, link %q", errInvalidEntry, p.Title, p.Link)
 	}
-	return parts[len(parts)-3], nil
+}
+
+func (p *Package) Name() (string, error) {
+	name, _, err := p.NameVersion()
+	return name, err
 }
 
 func (p *Package) Version() (string, error) {
-	// The XML Link splits to: []string{"https:", "", "pypi.org", "project", "foopy", "2.1", ""}
-	parts := strings.Split(p.Link, "/")
-	if len(parts) < 5 {
-		return "", errInvalidLinkForPackage
+	_, version, err := p.NameVersion()
+	return version, err
+}
+
+// ProjectName returns the normalized name of a project listed by the new projects
+// feed, parsed from the title, formatted as "{name} added to PyPI", or otherwise
+// the link, formatted as "https://pypi.org/project/{name}/".
+func (p *Package) ProjectName() (string, error) {
+	name, ok := strings.CutSuffix(strings.TrimSpace(p.Title), newProjectTitleSuffix)
+	if ok && validName.MatchString(name) {
+		return normalizeName(name), nil
+	}
+	segments := linkSegments(p.Link)
+	if len(segments) == 2 && validName.MatchString(segments[1]) {
+		return normalizeName(segments[1]), nil
+	}
+	return "", fmt.Errorf("%w : title %q, link %q", errInvalidEntry, p.Title, p.Link)
+}
+
+// parseTitle parses the name and version from the title of a release.
+func parseTitle(title string) (string, string, bool) {
+	fields := strings.Fields(title)
+	if len(fields) != 2 || !validName.MatchString(fields[0]) {
+		return "", "", false
 	}
-	return parts[len(parts)-2], nil
+	return fields[0], fields[1], true
+}
+
+// parseLink parses the name and version from the link of a release.
+func parseLink(link string) (string, string, bool) {
+	segments := linkSegments(link)
+	if len(segments) != 3 || !validName.MatchString(segments[1]) || segments[2] == "" {
+		return "", "", false
+	}
+	return segments[1], segments[2], true
+}
+
+// linkSegments returns the segments of a link's path from the "project" segment
+// onwards, so that the position of the name does not depend on any prefix of the
+// path.
+func linkSegments(link string) []string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return nil
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "project" {
+			return segments[i:]
+		}
+	}
+	return nil
 }
 
 type rfc1123Time struct {
@@ -75,12 +155,16 @@ func (t *rfc1123Time) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error
 	return nil
 }
 
-func fetchPackages(baseURL string) ([]*Package, error) {
-	pkgURL, err := url.JoinPath(baseURL, updatesPath)
+func fetchPackages(ctx context.Context, baseURL, path string) ([]*Package, error) {
+	pkgURL, err := url.JoinPath(baseURL, path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pkgURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := httpClient.Get(pkgURL)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -100,130 +184,192 @@ func fetchPackages(baseURL string) ([]*Package, error) {
 	return rssResponse.Packages, nil
 }
 
-func fetchCriticalPackages(baseURL string, packageList []string) ([]*Package, []error) {
-	responseChannel := make(chan *Response)
-	errChannel := make(chan error)
-
-	for _, pkgName := range packageList {
-		go func(pkgName string) {
-			packageDataPath := fmt.Sprintf(packagePathFormat, pkgName)
-			pkgURL, err := url.JoinPath(baseURL, packageDataPath)
-			if err != nil {
-				errChannel <- feeds.PackagePollError{Name: pkgName, Err: err}
-				return
-			}
-			resp, err := httpClient.Get(pkgURL)
-			if err != nil {
-				errChannel <- feeds.PackagePollError{Name: pkgName, Err: err}
-				return
-			}
-			defer resp.Body.Close()
-
-			err = utils.CheckResponseStatus(resp)
-			if err != nil {
-				errChannel <- feeds.PackagePollError{Name: pkgName, Err: fmt.Errorf("failed to fetch pypi package data: %w", err)}
-				return
-			}
-
-			rssResponse := &Response{}
-			reader := utils.NewXMLReader(resp.Body, true)
-			err = xml.NewDecoder(reader).Decode(rssResponse)
-			if err != nil {
-				errChannel <- feeds.PackagePollError{Name: pkgName, Err: err}
-				return
-			}
-
-			responseChannel <- rssResponse
-		}(pkgName)
-	}
-
-	pkgs := []*Package{}
-	errs := []error{}
-	for i := 0; i < len(packageList); i++ {
-		select {
-		case response := <-responseChannel:
-			pkgs = append(pkgs, response.Packages...)
-		case err := <-errChannel:
-			errs = append(errs, err)
-		}
-	}
-	return pkgs, errs
-}
-
 type Feed struct {
 	packages *[]string
 
 	lossyFeedAlerter *feeds.LossyFeedAlerter
+	eventHandler     *events.Handler
 	baseURL          string
 
 	options feeds.FeedOptions
+
+	// mu guards files, which holds the files of each project seen by previous
+	// polls when the packages option is set, mapped to whether the file was
+	// yanked.
+	mu    sync.Mutex
+	files map[string]map[string]bool
 }
 
 func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, error) {
 	return &Feed{
 		packages:         feedOptions.Packages,
 		lossyFeedAlerter: feeds.NewLossyFeedAlerter(eventHandler),
+		eventHandler:     eventHandler,
 		baseURL:          "https://pypi.org/",
 		options:          feedOptions,
+		files:            map[string]map[string]bool{},
 	}, nil
 }
 
-func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
-	pkgs := []*feeds.Package{}
-	var pypiPackages []*Package
-	var errs []error
-	var err error
-
-	if feed.packages == nil {
-		// Firehose fetch all packages.
-		// If this fails then we need to return, as it's the only source of
-		// data.
-		pypiPackages, err = fetchPackages(feed.baseURL)
-		if err != nil {
-			return nil, cutoff, append(errs, err)
-		}
-	} else {
+func (feed *Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	if feed.packages != nil {
 		// Fetch specific packages individually from configured packages list.
-		pypiPackages, errs = fetchCriticalPackages(feed.baseURL, *feed.packages)
-		if len(pypiPackages) == 0 {
+		uploads, yanks, errs := feed.fetchCriticalPackages(ctx, *feed.packages, cutoff)
+		if len(errs) == len(*feed.packages) && len(errs) != 0 {
 			// If none of the packages were successfully polled for, return early.
 			return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
 		}
+		// Yanks are created at the time they were detected, so only uploads move
+		// the cutoff.
+		return append(uploads, yanks...), feeds.FindCutoff(cutoff, uploads), errs
+	}
+
+	pkgs := []*feeds.Package{}
+	var errs []error
+
+	// Firehose fetch all packages.
+	// If this fails then we need to return, as it's the only source of
+	// data.
+	pypiPackages, err := fetchPackages(ctx, feed.baseURL, updatesPath)
+	if err != nil {
+		return nil, cutoff, append(errs, err)
 	}
 
 	for _, pkg := range pypiPackages {
-		pkgName, err := pkg.Name()
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-		pkgVersion, err := pkg.Version()
+		pkgName, pkgVersion, err := pkg.NameVersion()
 		if err != nil {
-			errs = append(errs, err)
+			errs = append(errs, feeds.PackagePollError{Name: pkg.Title, Err: err})
 			continue
 		}
 		pkg := feeds.NewPackage(pkg.CreatedDate.Time, pkgName, pkgVersion, FeedName)
 		pkgs = append(pkgs, pkg)
 	}
+	feed.lossyFeedAlerter.ProcessPackages(feed.options.InstanceName(FeedName), pkgs)
 
-	// Lossy feed detection is only necessary for firehose fetching
-	if feed.packages == nil {
-		feed.lossyFeedAlerter.ProcessPackages(FeedName, pkgs)
+	// The updates are still returned if the new projects cannot be fetched, without
+	// marking first releases.
+	newProjects, err := fetchPackages(ctx, feed.baseURL, newProjectsPath)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		var newProjectErrs []error
+		pkgs, newProjectErrs = feed.markFirstReleases(ctx, pkgs, newProjects, cutoff)
+		errs = append(errs, newProjectErrs...)
 	}
 
 	newCutoff := feeds.FindCutoff(cutoff, pkgs)
 	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
+	for _, pkg := range pkgs {
+		if pkg.FirstRelease {
+			err := feed.eventHandler.DispatchEvent(events.NewProjectEvent{
+				Feed:    feed.options.InstanceName(FeedName),
+				Name:    pkg.Name,
+				Version: pkg.Version,
+			})
+			if err != nil {
+				log.WithError(err).Error("failed to dispatch event via event handler")
+			}
+		}
+	}
 	return pkgs, newCutoff, errs
 }
 
-func (feed Feed) GetPackageList() *[]string {
+// markFirstReleases marks the first release of each project created since the
+// cutoff. The earliest release of the project in the updates is marked, or if
+// the project has no releases in the updates, its first release is fetched from
+// the JSON API and added to the packages.
+func (feed *Feed) markFirstReleases(
+	ctx context.Context, pkgs []*feeds.Package, newProjects []*Package, cutoff time.Time,
+) ([]*feeds.Package, []error) {
+	earliest := map[string]*feeds.Package{}
+	for _, pkg := range pkgs {
+		if e, ok := earliest[pkg.Name]; !ok || pkg.CreatedDate.Before(e.CreatedDate) {
+			earliest[pkg.Name] = pkg
+		}
+	}
+
+	errs := []error{}
+	for _, project := range newProjects {
+		if !project.CreatedDate.After(cutoff) {
+			continue
+		}
+		name, err := project.ProjectName()
+		if err != nil {
+			errs = append(errs, feeds.PackagePollError{Name: project.Title, Err: err})
+			continue
+		}
+		if pkg, ok := earliest[name]; ok {
+			pkg.FirstRelease = true
+			continue
+		}
+		first, err := feed.fetchFirstRelease(ctx, name)
+		if err != nil {
+			errs = append(errs, feeds.PackagePollError{Name: name, Err: err})
+			continue
+		}
+		pkgs = append(pkgs, first...)
+	}
+	return pkgs, errs
+}
+
+// fetchFirstRelease returns the earliest release of a project, or no packages if
+// nothing has been uploaded to the project.
+func (feed *Feed) fetchFirstRelease(ctx context.Context, name string) ([]*feeds.Package, error) {
+	project, err := fetchProject(ctx, feed.baseURL, name)
+	if err != nil {
+		return nil, err
+	}
+	files := project.files()
+	if len(files) == 0 {
+		return []*feeds.Package{}, nil
+	}
+	pkg := feeds.NewPackage(files[0].UploadTime, normalizeName(project.Info.Name), files[0].version, FeedName)
+	pkg.FirstRelease = true
+	return []*feeds.Package{pkg}, nil
+}
+
+func (feed *Feed) GetPackageList() *[]string {
 	return feed.packages
 }
 
-func (feed Feed) GetName() string {
+// Cursor returns the files of each project seen by previous polls when the
+// packages option is set, so that files yanked or unyanked while the feed is
+// stopped are detected after a restart.
+func (feed *Feed) Cursor() string {
+	if feed.packages == nil {
+		return ""
+	}
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	b, err := json.Marshal(feed.files)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode pypi cursor")
+		return ""
+	}
+	return string(b)
+}
+
+// SetCursor restores the files of each project seen by previous polls. A cursor
+// which cannot be decoded is ignored, so that each project is polled as if it
+// was not seen before.
+func (feed *Feed) SetCursor(cursor string) {
+	if feed.packages == nil || cursor == "" {
+		return
+	}
+	files := map[string]map[string]bool{}
+	if err := json.Unmarshal([]byte(cursor), &files); err != nil {
+		log.WithError(err).Warn("Ignoring invalid pypi cursor")
+		return
+	}
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.files = files
+}
+
+func (feed *Feed) GetName() string {
 	return FeedName
 }
 
-func (feed Feed) GetFeedOptions() feeds.FeedOptions {
+func (feed *Feed) GetFeedOptions() feeds.FeedOptions {
 	return feed.options
 }
@@ -1,48 +1,183 @@
 package pypi
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/kolo/xmlrpc"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/useragent"
 )
 
 const (
 	ArtifactFeedName = "pypi-artifacts"
+
+	// changelogLimit is the maximum number of entries returned by PyPI for a
+	// single changelog call, the oldest entries since the cutoff are returned.
+	changelogLimit = 50000
+
+	// maxChangelogPages bounds the number of changelog calls made by each call to
+	// Latest, larger windows are paged through by subsequent calls.
+	maxChangelogPages = 10
 )
 
-// We care about changelog entries where the action is 'add X file <filename>'.
-var archiveUploadAction = regexp.MustCompile("add (.*) file (.*)")
+var (
+	// We care about changelog entries where the action is 'add X file <filename>'.
+	archiveUploadAction = regexp.MustCompile("add (.*) file (.*)")
+	nameSeparators      = regexp.MustCompile(`[-_.]+`)
+)
+
+// xmlrpcCaller is the subset of the xmlrpc client used to query the changelog.
+type xmlrpcCaller interface {
+	Call(serviceMethod string, args, reply interface{}) error
+}
 
 type ArtifactFeed struct {
 	baseURL string
+
+	// packages holds the normalized names of the packages to poll, or is nil to
+	// poll all packages.
+	packages     map[string]bool
+	eventHandler *events.Handler
+
 	options feeds.FeedOptions
 }
 
-func NewArtifactFeed(feedOptions feeds.FeedOptions) (*ArtifactFeed, error) {
+func NewArtifactFeed(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*ArtifactFeed, error) {
+	var packages map[string]bool
+	if feedOptions.Packages != nil {
+		packages = map[string]bool{}
+		for _, name := range *feedOptions.Packages {
+			packages[normalizeName(name)] = true
+		}
+	}
 	return &ArtifactFeed{
-		baseURL: "https://pypi.org/pypi",
-		options: feedOptions,
+		baseURL:      "https://pypi.org/pypi",
+		packages:     packages,
+		eventHandler: eventHandler,
+		options:      feedOptions,
 	}, nil
 }
 
-func (feed ArtifactFeed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
-	client, err := xmlrpc.NewClient(feed.baseURL, &useragent.RoundTripper{UserAgent: feeds.DefaultUserAgent})
+// contextRoundTripper attaches a context to each request, as the xmlrpc client
+// does not support contexts itself.
+type contextRoundTripper struct {
+	ctx    context.Context
+	parent http.RoundTripper
+}
+
+func (rt contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.parent.RoundTrip(req.WithContext(rt.ctx))
+}
+
+func (feed ArtifactFeed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	client, err := xmlrpc.NewClient(feed.baseURL, contextRoundTripper{
+		ctx:    ctx,
+		parent: &useragent.RoundTripper{UserAgent: feeds.DefaultUserAgent},
+	})
 	if err != nil {
 		return nil, cutoff, []error{err}
 	}
+	defer client.Close()
 
-	changelogEntries, err := getPyPIChangeLog(client, cutoff)
+	return feed.latest(client, cutoff)
+}
+
+func (feed ArtifactFeed) latest(client xmlrpcCaller, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	changelogEntries, newCutoff, err := feed.fetchChangelog(client, cutoff)
 	if err != nil {
 		return nil, cutoff, []error{err}
 	}
 
-	pkgs := getUploadedArtifacts(changelogEntries)
-	return pkgs, feeds.FindCutoff(cutoff, pkgs), nil
+	pkgs := []*feeds.Package{}
+	for _, pkg := range getUploadedArtifacts(changelogEntries) {
+		if feed.packages == nil || feed.packages[normalizeName(pkg.Name)] {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs, feeds.FindCutoff(newCutoff, pkgs), nil
+}
+
+// fetchChangelog returns the changelog entries since cutoff, paging through the
+// changelog when more than changelogLimit entries are available. The returned
+// cutoff is the time up to which all changelog entries have been returned.
+func (feed ArtifactFeed) fetchChangelog(
+	client xmlrpcCaller, cutoff time.Time,
+) ([]pypiChangelogEntry, time.Time, error) {
+	entries := []pypiChangelogEntry{}
+	seen := map[pypiChangelogEntry]bool{}
+	since := cutoff
+	for page := 1; ; page++ {
+		result, err := getPyPIChangeLog(client, since)
+		if err != nil {
+			return nil, cutoff, err
+		}
+		for _, e := range result {
+			if !seen[e] {
+				seen[e] = true
+				entries = append(entries, e)
+			}
+			if e.Timestamp.After(cutoff) {
+				cutoff = e.Timestamp
+			}
+		}
+		if len(result) < changelogLimit {
+			return entries, cutoff, nil
+		}
+
+		// The changelog was truncated, entries in the same second as the last entry
+		// may be missing as the changelog has a resolution of one second.
+		last := result[len(result)-1].Timestamp
+		skipped := result[0].Timestamp.Equal(last)
+		if skipped {
+			// The entries of a single second exceed the changelog limit, so the
+			// remainder of the second cannot be fetched.
+			log.WithField("timestamp", last).Warn("Skipping PyPI changelog entries which exceed the changelog limit")
+			err := feed.eventHandler.DispatchEvent(events.LossyFeedEvent{Feed: feed.options.InstanceName(ArtifactFeedName)})
+			if err != nil {
+				log.WithError(err).Error("failed to dispatch event via event handler")
+			}
+			since = last
+		} else {
+			since = last.Add(-time.Second)
+		}
+		if page == maxChangelogPages {
+			if skipped {
+				return entries, cutoff, nil
+			}
+			// Leave the last second to be fetched in full by the next call.
+			return entriesBefore(entries, last), since, nil
+		}
+	}
+}
+
+// entriesBefore returns the changelog entries with a timestamp before t.
+func entriesBefore(entries []pypiChangelogEntry, t time.Time) []pypiChangelogEntry {
+	filtered := []pypiChangelogEntry{}
+	for _, e := range entries {
+		if e.Timestamp.Before(t) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// normalizeName normalizes a project name as defined by
+// https://packaging.python.org/en/latest/specifications/name-normalization/
+func normalizeName(name string) string {
+	return strings.ToLower(nameSeparators.ReplaceAllString(name, "-"))
+}
+
+// SupportsBackfill returns true, as the changelog can be queried from any point in time.
+func (feed ArtifactFeed) SupportsBackfill() bool {
+	return true
 }
 
 func (feed ArtifactFeed) GetFeedOptions() feeds.FeedOptions {
@@ -71,7 +206,7 @@ func (e *pypiChangelogEntry) String() string {
 
 // getPyPIChangeLog returns a list of PyPI changelog entries since the given timestamp
 // defined by https://warehouse.pypa.io/api-reference/xml-rpc.html#changelog-since-with-ids-false
-func getPyPIChangeLog(client *xmlrpc.Client, since time.Time) ([]pypiChangelogEntry, error) {
+func getPyPIChangeLog(client xmlrpcCaller, since time.Time) ([]pypiChangelogEntry, error) {
 	// Raw result structure is array[array[string, string|nil, int64, string (, int64 if with_ids=true) ]]
 	// which cannot be represented in Go (struct mapping is not supported by library)
 	var result [][]interface{}
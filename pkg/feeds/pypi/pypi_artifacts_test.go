@@ -1,10 +1,14 @@
 package pypi
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 )
 
@@ -397,13 +401,13 @@ var testChangelogEntries = []pypiChangelogEntry{
 func TestPyPIArtifactsLive(t *testing.T) {
 	t.Parallel()
 
-	feed, err := NewArtifactFeed(feeds.FeedOptions{})
+	feed, err := NewArtifactFeed(feeds.FeedOptions{}, events.NewNullHandler())
 	if err != nil {
 		t.Fatalf("Failed to create new pypi-artifacts feed: %v", err)
 	}
 
 	cutoff := time.Now().AddDate(0, 0, -1)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("feed.Latest returned error: %v", errs)
 	}
@@ -418,13 +422,13 @@ func TestPyPIArtifactsLive(t *testing.T) {
 
 	for _, p := range pkgs {
 		if p.Name == "" {
-			t.Errorf("Package has no name: %s", p)
+			t.Errorf("Package has no name: %v", p)
 		}
 		if p.Version == "" {
-			t.Errorf("Package has no version: %s", p)
+			t.Errorf("Package has no version: %v", p)
 		}
 		if p.ArtifactID == "" {
-			t.Errorf("Package has no artifact ID: %s", p)
+			t.Errorf("Package has no artifact ID: %v", p)
 		}
 		if p.CreatedDate.Unix() < cutoff.Unix() {
 			t.Errorf("Package create date (%s) is before cutoff (%s)", p.CreatedDate, cutoff)
@@ -436,6 +440,170 @@ func TestPyPIArtifactsLive(t *testing.T) {
 	}
 }
 
+var errUnexpectedCall = errors.New("unexpected xmlrpc call")
+
+// mockChangelog serves a changelog from raw entries in the same way as PyPI, the
+// entries must be sorted by timestamp.
+type mockChangelog struct {
+	entries [][]interface{}
+	calls   *int
+}
+
+func (m mockChangelog) Call(serviceMethod string, args, reply interface{}) error {
+	params, ok := args.([]interface{})
+	if serviceMethod != "changelog" || !ok || len(params) != 2 {
+		return errUnexpectedCall
+	}
+	since, ok := params[0].(int64)
+	if !ok {
+		return errUnexpectedCall
+	}
+	*m.calls++
+	result := [][]interface{}{}
+	for _, e := range m.entries {
+		if e[2].(int64) > since && len(result) < changelogLimit {
+			result = append(result, e)
+		}
+	}
+	*reply.(*[][]interface{}) = result
+	return nil
+}
+
+// uploadsEverySecond returns changelog entries for n file uploads, perSecond of
+// which are uploaded in each second after start.
+func uploadsEverySecond(start int64, n, perSecond int) [][]interface{} {
+	entries := [][]interface{}{}
+	for i := 0; i < n; i++ {
+		entries = append(entries, []interface{}{
+			"foo", "1.0.0", start + 1 + int64(i/perSecond), fmt.Sprintf("add py3 file foo-1.0.0-%d.whl", i),
+		})
+	}
+	return entries
+}
+
+func TestArtifactFeedPackagesOption(t *testing.T) {
+	t.Parallel()
+
+	feed, err := NewArtifactFeed(feeds.FeedOptions{
+		Packages: &[]string{"Benchling.API_Client", "adbutils"},
+	}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create new pypi-artifacts feed: %v", err)
+	}
+
+	calls := 0
+	cutoff := time.Unix(1678414000, 0)
+	pkgs, gotCutoff, errs := feed.latest(mockChangelog{entries: testAPIData, calls: &calls}, cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.latest returned error: %v", errs)
+	}
+	if len(pkgs) != 6 {
+		t.Fatalf("feed.latest returned %d packages, want 6", len(pkgs))
+	}
+	for _, pkg := range pkgs {
+		if pkg.Name != "benchling-api-client" && pkg.Name != "adbutils" {
+			t.Errorf("feed.latest returned unexpected package %s", pkg.Name)
+		}
+	}
+	// The cutoff follows the changelog, rather than the last matching package.
+	if want := time.Unix(1678415403, 0); !gotCutoff.Equal(want) {
+		t.Errorf("feed.latest cutoff %v, want %v", gotCutoff, want)
+	}
+}
+
+func TestArtifactFeedPagesChangelog(t *testing.T) {
+	t.Parallel()
+
+	feed, err := NewArtifactFeed(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create new pypi-artifacts feed: %v", err)
+	}
+
+	const numUploads = changelogLimit*2 + 10
+	start := int64(1678414000)
+	calls := 0
+	changelog := mockChangelog{entries: uploadsEverySecond(start, numUploads, 3), calls: &calls}
+	pkgs, gotCutoff, errs := feed.latest(changelog, time.Unix(start, 0))
+	if len(errs) != 0 {
+		t.Fatalf("feed.latest returned error: %v", errs)
+	}
+	if calls != 3 {
+		t.Errorf("feed.latest made %d changelog calls, want 3", calls)
+	}
+	if len(pkgs) != numUploads {
+		t.Errorf("feed.latest returned %d packages, want %d", len(pkgs), numUploads)
+	}
+	if want := time.Unix(start+1+(numUploads-1)/3, 0); !gotCutoff.Equal(want) {
+		t.Errorf("feed.latest cutoff %v, want %v", gotCutoff, want)
+	}
+}
+
+func TestArtifactFeedPageLimit(t *testing.T) {
+	t.Parallel()
+
+	feed, err := NewArtifactFeed(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create new pypi-artifacts feed: %v", err)
+	}
+
+	const numUploads = changelogLimit * (maxChangelogPages + 1)
+	start := int64(1678414000)
+	calls := 0
+	changelog := mockChangelog{entries: uploadsEverySecond(start, numUploads, 4), calls: &calls}
+	cutoff := time.Unix(start, 0)
+	total := 0
+	for i := 0; i < 2; i++ {
+		pkgs, gotCutoff, errs := feed.latest(changelog, cutoff)
+		if len(errs) != 0 {
+			t.Fatalf("feed.latest returned error: %v", errs)
+		}
+		for _, pkg := range pkgs {
+			if !pkg.CreatedDate.After(cutoff) || pkg.CreatedDate.After(gotCutoff) {
+				t.Fatalf("feed.latest returned package created at %v outside of (%v, %v]",
+					pkg.CreatedDate, cutoff, gotCutoff)
+			}
+		}
+		total += len(pkgs)
+		cutoff = gotCutoff
+	}
+	if calls > 2*maxChangelogPages {
+		t.Errorf("feed.latest made %d changelog calls, want at most %d", calls, 2*maxChangelogPages)
+	}
+	if total != numUploads {
+		t.Errorf("feed.latest returned %d packages over two calls, want %d", total, numUploads)
+	}
+}
+
+func TestArtifactFeedLossySecond(t *testing.T) {
+	t.Parallel()
+
+	sink := &events.MockSink{}
+	filter := events.NewFilter([]string{events.LossyFeedEventType}, nil, nil)
+	feed, err := NewArtifactFeed(feeds.FeedOptions{}, events.NewHandler(sink, *filter))
+	if err != nil {
+		t.Fatalf("Failed to create new pypi-artifacts feed: %v", err)
+	}
+
+	// More uploads than the changelog limit within the first second.
+	start := int64(1678414000)
+	entries := uploadsEverySecond(start, changelogLimit+5, changelogLimit+5)
+	entries = append(entries, []interface{}{"bar", "1.0.0", start + 2, "add source file bar-1.0.0.tar.gz"})
+	calls := 0
+	pkgs, gotCutoff, errs := feed.latest(mockChangelog{entries: entries, calls: &calls}, time.Unix(start, 0))
+	if len(errs) != 0 {
+		t.Fatalf("feed.latest returned error: %v", errs)
+	}
+	if len(sink.GetEvents()) != 1 {
+		t.Errorf("feed.latest dispatched %d events, want 1", len(sink.GetEvents()))
+	}
+	if len(pkgs) != changelogLimit+1 || pkgs[len(pkgs)-1].Name != "bar" {
+		t.Errorf("feed.latest returned %d packages, want %d ending with bar", len(pkgs), changelogLimit+1)
+	}
+	if want := time.Unix(start+2, 0); !gotCutoff.Equal(want) {
+		t.Errorf("feed.latest cutoff %v, want %v", gotCutoff, want)
+	}
+}
+
 func TestProcessRawChangelog(t *testing.T) {
 	t.Parallel()
 
@@ -468,7 +636,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678414652, 0),
 			ArtifactID:  "supertemplater-1.4.0-py3-none-any.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "supertemplater",
@@ -476,7 +644,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678414654, 0),
 			ArtifactID:  "supertemplater-1.4.0.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "OpenVisus",
@@ -484,7 +652,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678414663, 0),
 			ArtifactID:  "OpenVisus-2.2.96-cp310-none-macosx_10_9_x86_64.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "OpenVisusNoGui",
@@ -492,7 +660,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678414694, 0),
 			ArtifactID:  "OpenVisusNoGui-2.2.96-cp310-none-macosx_10_9_x86_64.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "benchling-api-client",
@@ -500,7 +668,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678414736, 0),
 			ArtifactID:  "benchling_api_client-2.0.118-py3-none-any.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "benchling-api-client",
@@ -508,7 +676,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678414738, 0),
 			ArtifactID:  "benchling_api_client-2.0.118.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "adbutils",
@@ -516,7 +684,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415161, 0),
 			ArtifactID:  "adbutils-1.2.9-py3-none-manylinux1_x86_64.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "adbutils",
@@ -524,7 +692,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415164, 0),
 			ArtifactID:  "adbutils-1.2.9-py3-none-win32.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "adbutils",
@@ -532,7 +700,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415166, 0),
 			ArtifactID:  "adbutils-1.2.9-py3-none-win_amd64.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "adbutils",
@@ -540,7 +708,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415167, 0),
 			ArtifactID:  "adbutils-1.2.9.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "qiskit-qasm2",
@@ -548,7 +716,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415182, 0),
 			ArtifactID:  "qiskit_qasm2-0.5.1.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "genai",
@@ -556,7 +724,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415278, 0),
 			ArtifactID:  "genai-0.12.0a0-py3-none-any.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "genai",
@@ -564,7 +732,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415281, 0),
 			ArtifactID:  "genai-0.12.0a0.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "chia-blockchain",
@@ -572,7 +740,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415319, 0),
 			ArtifactID:  "chia-blockchain-1.7.1rc1.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "ScraperFC",
@@ -580,7 +748,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415386, 0),
 			ArtifactID:  "ScraperFC-2.6.3-py3-none-any.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "ScraperFC",
@@ -588,7 +756,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415389, 0),
 			ArtifactID:  "ScraperFC-2.6.3.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "callpyfile",
@@ -596,7 +764,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415402, 0),
 			ArtifactID:  "callpyfile-0.10-py3-none-any.whl",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 		{
 			Name:        "callpyfile",
@@ -604,7 +772,7 @@ func TestCachedLatest(t *testing.T) {
 			CreatedDate: time.Unix(1678415403, 0),
 			ArtifactID:  "callpyfile-0.10.tar.gz",
 			Type:        ArtifactFeedName,
-			SchemaVer:   "1.1",
+			SchemaVer:   "1.6",
 		},
 	}
 
@@ -618,10 +786,10 @@ func TestCachedLatest(t *testing.T) {
 		if i < len(actualResults) {
 			a := actualResults[i]
 			if !reflect.DeepEqual(a, e) {
-				t.Errorf("Mismatch between expectedResult[%d] and actualResult[%d]: want %s, got %s", i, i, e, a)
+				t.Errorf("Mismatch between expectedResult[%d] and actualResult[%d]: want %v, got %v", i, i, e, a)
 			}
 		} else {
-			t.Errorf("expectedResult[%d] with value %s but got no actual result with this index", i, e)
+			t.Errorf("expectedResult[%d] with value %v but got no actual result with this index", i, e)
 		}
 	}
 }
@@ -1,14 +1,18 @@
 package pypi
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
 	testutils "github.com/ossf/package-feeds/pkg/utils/test"
 )
 
@@ -16,7 +20,9 @@ func TestPypiLatest(t *testing.T) {
 	t.Parallel()
 
 	handlers := map[string]testutils.HTTPHandlerFunc{
-		updatesPath: updatesXMLHandle,
+		updatesPath:        updatesXMLHandle,
+		newProjectsPath:    newProjectsXMLHandle,
+		"/pypi/bazpy/json": bazpyProjectResponse,
 	}
 	srv := testutils.HTTPServerMock(handlers)
 
@@ -27,7 +33,7 @@ func TestPypiLatest(t *testing.T) {
 	feed.baseURL = srv.URL
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("feed.Latest returned error: %v", err)
 	}
@@ -38,11 +44,12 @@ func TestPypiLatest(t *testing.T) {
 		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
 	}
 
-	if pkgs[0].Name != "FooPackage" {
-		t.Errorf("Unexpected package `%s` found in place of expected `FooPackage`", pkgs[0].Name)
+	// Names are normalized.
+	if pkgs[0].Name != "foopackage" {
+		t.Errorf("Unexpected package `%s` found in place of expected `foopackage`", pkgs[0].Name)
 	}
-	if pkgs[1].Name != "BarPackage" {
-		t.Errorf("Unexpected package `%s` found in place of expected `BarPackage`", pkgs[1].Name)
+	if pkgs[1].Name != "barpackage" {
+		t.Errorf("Unexpected package `%s` found in place of expected `barpackage`", pkgs[1].Name)
 	}
 	if pkgs[0].Version != "0.0.2" {
 		t.Errorf("Unexpected version `%s` found in place of expected `0.0.2`", pkgs[0].Version)
@@ -58,12 +65,278 @@ func TestPypiLatest(t *testing.T) {
 	}
 }
 
+func TestPypiLatestNewProjects(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		updatesPath:        updatesXMLHandle,
+		newProjectsPath:    newProjectsXMLHandle,
+		"/pypi/bazpy/json": bazpyProjectResponse,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	sink := &events.MockSink{}
+	filter := events.NewFilter([]string{events.NewProjectEventType}, nil, nil)
+	feed, err := New(feeds.FeedOptions{}, events.NewHandler(sink, *filter))
+	if err != nil {
+		t.Fatalf("Failed to create new pypi feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(2021, 3, 19, 11, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+
+	// BarPackage was created within the updates, while the first release of bazpy
+	// is fetched from the JSON API. FooPackage was created before the cutoff.
+	firstReleases := map[string]string{}
+	for _, pkg := range pkgs {
+		if pkg.FirstRelease {
+			firstReleases[pkg.Name] = pkg.Version
+		}
+	}
+	want := map[string]string{"barpackage": "0.7a2", "bazpy": "0.1.0"}
+	if !reflect.DeepEqual(firstReleases, want) {
+		t.Errorf("Latest() marked first releases %v, want %v", firstReleases, want)
+	}
+
+	if len(sink.GetEvents()) != 2 {
+		t.Fatalf("Latest() dispatched %d events, want 2", len(sink.GetEvents()))
+	}
+	for _, e := range sink.GetEvents() {
+		if e.GetType() != events.NewProjectEventType {
+			t.Errorf("Latest() dispatched a %s event, want %s", e.GetType(), events.NewProjectEventType)
+		}
+	}
+}
+
+func TestPypiLatestNewProjectsNotFound(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		updatesPath:     updatesXMLHandle,
+		newProjectsPath: testutils.NotFoundHandlerFunc,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create new pypi feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 1 || !errors.Is(errs[0], utils.ErrUnsuccessfulRequest) {
+		t.Fatalf("feed.Latest() returned errors %v, want a single unsuccessful request", errs)
+	}
+	// The updates are returned without the new projects.
+	if len(pkgs) != 2 {
+		t.Fatalf("Latest() produced %v packages instead of the expected %v", len(pkgs), 2)
+	}
+}
+
+func TestPackageNameVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		title       string
+		link        string
+		wantName    string
+		wantVersion string
+		wantErr     error
+	}{
+		{
+			name:        "simple",
+			title:       "foopy 2.1",
+			link:        "https://pypi.org/project/foopy/2.1/",
+			wantName:    "foopy",
+			wantVersion: "2.1",
+		},
+		{
+			name:        "dots and underscores",
+			title:       "Zope.Interface_Extra 5.4.0",
+			link:        "https://pypi.org/project/Zope.Interface_Extra/5.4.0/",
+			wantName:    "zope-interface-extra",
+			wantVersion: "5.4.0",
+		},
+		{
+			name:        "title and link differ in separators",
+			title:       "foo_bar 1.0",
+			link:        "https://pypi.org/project/foo-bar/1.0/",
+			wantName:    "foo-bar",
+			wantVersion: "1.0",
+		},
+		{
+			name:        "local version",
+			title:       "torch 2.1.0+cu118",
+			link:        "https://pypi.org/project/torch/2.1.0+cu118/",
+			wantName:    "torch",
+			wantVersion: "2.1.0+cu118",
+		},
+		{
+			name:        "epoch",
+			title:       "calver-pkg 1!2024.1",
+			link:        "https://pypi.org/project/calver-pkg/1!2024.1/",
+			wantName:    "calver-pkg",
+			wantVersion: "1!2024.1",
+		},
+		{
+			name:        "pre-release",
+			title:       "BarPackage 0.7a2",
+			link:        "https://pypi.org/project/BarPackage/0.7a2/",
+			wantName:    "barpackage",
+			wantVersion: "0.7a2",
+		},
+		{
+			name:        "single character name",
+			title:       "x 0.0.1",
+			link:        "https://pypi.org/project/x/0.0.1/",
+			wantName:    "x",
+			wantVersion: "0.0.1",
+		},
+		{
+			name:        "link with a path prefix and no trailing slash",
+			title:       "foopy 2.1",
+			link:        "https://mirror.example.com/pypi/project/foopy/2.1",
+			wantName:    "foopy",
+			wantVersion: "2.1",
+		},
+		{
+			name:        "link only",
+			title:       "",
+			link:        "https://pypi.org/project/foopy/2.1/",
+			wantName:    "foopy",
+			wantVersion: "2.1",
+		},
+		{
+			name:        "title only",
+			title:       "foopy 2.1",
+			link:        "https://pypi.org/foopy/",
+			wantName:    "foopy",
+			wantVersion: "2.1",
+		},
+		{
+			name:    "mismatched name",
+			title:   "foopy 2.1",
+			link:    "https://pypi.org/project/barpy/2.1/",
+			wantErr: errMismatchedEntry,
+		},
+		{
+			name:    "mismatched version",
+			title:   "foopy 2.1",
+			link:    "https://pypi.org/project/foopy/2.0/",
+			wantErr: errMismatchedEntry,
+		},
+		{
+			name:    "unparseable",
+			title:   "foopy",
+			link:    "https://pypi.org/project/foopy/",
+			wantErr: errInvalidEntry,
+		},
+		{
+			name:    "invalid name",
+			title:   "-foopy- 2.1",
+			link:    "https://pypi.org/project/-foopy-/2.1/",
+			wantErr: errInvalidEntry,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Package{Title: test.title, Link: test.link}
+			gotName, gotVersion, err := p.NameVersion()
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("NameVersion() error = %v, want %v", err, test.wantErr)
+			}
+			if gotName != test.wantName || gotVersion != test.wantVersion {
+				t.Errorf("NameVersion() = %q, %q, want %q, %q", gotName, gotVersion, test.wantName, test.wantVersion)
+			}
+		})
+	}
+}
+
+func TestPackageProjectName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		title   string
+		link    string
+		want    string
+		wantErr error
+	}{
+		{title: "Foo.Bar added to PyPI", link: "https://pypi.org/project/Foo.Bar/", want: "foo-bar"},
+		{title: "New project", link: "https://pypi.org/project/foo_bar/", want: "foo-bar"},
+		{title: "New project", link: "https://pypi.org/", wantErr: errInvalidEntry},
+	}
+	for _, test := range tests {
+		p := &Package{Title: test.title, Link: test.link}
+		got, err := p.ProjectName()
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("ProjectName() for %q error = %v, want %v", test.title, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("ProjectName() for %q = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
+
+func TestPypiLatestUnparseableEntry(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		updatesPath: func(w http.ResponseWriter, _ *http.Request) {
+			_, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel>
+	<item>
+		<title>foopy 2.1</title>
+		<link>https://pypi.org/project/foopy/2.1/</link>
+		<pubDate>Fri, 19 Mar 2021 12:01:04 GMT</pubDate>
+	</item>
+	<item>
+		<title>foopy 2.2</title>
+		<link>https://pypi.org/project/barpy/2.2/</link>
+		<pubDate>Fri, 19 Mar 2021 12:01:05 GMT</pubDate>
+	</item>
+</channel></rss>`))
+			if err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+		newProjectsPath: newProjectsXMLHandle,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create new pypi feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(2021, 3, 19, 12, 1, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 1 {
+		t.Fatalf("feed.Latest() returned %v errors when 1 was expected", len(errs))
+	}
+	var pollErr feeds.PackagePollError
+	if !errors.As(errs[0], &pollErr) || !errors.Is(errs[0], errMismatchedEntry) {
+		t.Errorf("feed.Latest() returned error %v, want a PackagePollError for the mismatched entry", errs[0])
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "foopy" {
+		t.Fatalf("Latest() produced %v, want only foopy 2.1", pkgs)
+	}
+}
+
 func TestPypiCriticalLatest(t *testing.T) {
 	t.Parallel()
 
 	handlers := map[string]testutils.HTTPHandlerFunc{
-		"/rss/project/foopy/releases.xml": foopyReleasesResponse,
-		"/rss/project/barpy/releases.xml": barpyReleasesResponse,
+		"/pypi/foopy/json": foopyProjectResponse,
+		"/pypi/barpy/json": barpyProjectResponse,
 	}
 	packages := []string{
 		"foopy",
@@ -80,7 +353,7 @@ func TestPypiCriticalLatest(t *testing.T) {
 	feed.baseURL = srv.URL
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("Failed to call Latest() with err: %v", errs[len(errs)-1])
 	}
@@ -91,29 +364,158 @@ func TestPypiCriticalLatest(t *testing.T) {
 		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
 	}
 
-	const expectedNumPackages = 4
+	// A package is returned for each file, followed by the yank of barpy 1.1.
+	const expectedNumPackages = 6
 	if len(pkgs) != expectedNumPackages {
 		t.Fatalf("Latest() produced %v packages instead of the expected %v", len(pkgs), expectedNumPackages)
 	}
-	pkgMap := map[string]map[string]*feeds.Package{}
-	pkgMap["foopy"] = map[string]*feeds.Package{}
-	pkgMap["barpy"] = map[string]*feeds.Package{}
+	pkgMap := map[string]*feeds.Package{}
+	for _, pkg := range pkgs[:5] {
+		if pkg.Event != "" {
+			t.Errorf("Unexpected %s event for %s", pkg.Event, pkg.ArtifactID)
+		}
+		pkgMap[pkg.ArtifactID] = pkg
+	}
+	for _, artifactID := range []string{
+		"foopy-2.0.tar.gz", "foopy-2.1.tar.gz", "foopy-2.1-py3-none-any.whl", "barpy-1.0.tar.gz", "barpy-1.1.tar.gz",
+	} {
+		if _, ok := pkgMap[artifactID]; !ok {
+			t.Fatalf("Missing %s", artifactID)
+		}
+	}
+	wheel := pkgMap["foopy-2.1-py3-none-any.whl"]
+	if wheel.Name != "foopy" || wheel.Version != "2.1" {
+		t.Errorf("Unexpected package %s %s for foopy-2.1-py3-none-any.whl", wheel.Name, wheel.Version)
+	}
+	wantChecksum := "sha256:3c8e1f2ad1e4ff2bd4e2b7a5c3b44f8c1a0d0f7e4b4c7f1e2e1d6c3b2a190807"
+	if wheel.Checksum != wantChecksum {
+		t.Errorf("Checksum %q, want %q", wheel.Checksum, wantChecksum)
+	}
+	if wheel.RequiresPython != ">=3.7" {
+		t.Errorf("RequiresPython %q, want %q", wheel.RequiresPython, ">=3.7")
+	}
+	if pkgs[5].ArtifactID != "barpy-1.1.tar.gz" || pkgs[5].Event != feeds.YankEvent {
+		t.Errorf("Latest() returned %s %s, want a yank of barpy-1.1.tar.gz", pkgs[5].ArtifactID, pkgs[5].Event)
+	}
+}
 
-	for _, pkg := range pkgs {
-		pkgMap[pkg.Name][pkg.Version] = pkg
+func TestPypiCriticalYanks(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/pypi/barpy/json": func(w http.ResponseWriter, r *http.Request) {
+			if polls.Add(1) == 1 {
+				barpyProjectResponse(w, r)
+				return
+			}
+			// barpy 1.0 has been yanked and barpy 1.1 unyanked since the first poll.
+			_, err := w.Write([]byte(`{"info":{"name":"barpy"},"releases":{
+				"1.0":[{"filename":"barpy-1.0.tar.gz","upload_time_iso_8601":"2018-09-23T16:50:37.000000Z",
+					"yanked":true}],
+				"1.1":[{"filename":"barpy-1.1.tar.gz","upload_time_iso_8601":"2021-03-27T22:16:26.000000Z",
+					"yanked":false}]}}`))
+			if err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+	}
+	packages := []string{"barpy"}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := New(feeds.FeedOptions{
+		Packages: &packages,
+	}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create pypi feed: %v", err)
 	}
+	feed.baseURL = srv.URL
 
-	if _, ok := pkgMap["foopy"]["2.1"]; !ok {
-		t.Fatalf("Missing foopy 2.1")
+	// Only files uploaded after the cutoff are returned by the first poll.
+	cutoff := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("Failed to call Latest() with err: %v", errs[len(errs)-1])
 	}
-	if _, ok := pkgMap["foopy"]["2.0"]; !ok {
-		t.Fatalf("Missing foopy 2.0")
+	if len(pkgs) != 2 || pkgs[0].ArtifactID != "barpy-1.1.tar.gz" || pkgs[1].Event != feeds.YankEvent {
+		t.Fatalf("Latest() produced %v, want barpy-1.1.tar.gz and its yank", pkgs)
 	}
-	if _, ok := pkgMap["barpy"]["1.1"]; !ok {
-		t.Fatalf("Missing barpy 1.1")
+
+	pkgs, _, errs = feed.Latest(context.Background(), gotCutoff)
+	if len(errs) != 0 {
+		t.Fatalf("Failed to call Latest() with err: %v", errs[len(errs)-1])
 	}
-	if _, ok := pkgMap["barpy"]["1.0"]; !ok {
-		t.Fatalf("Missing barpy 1.0")
+	if len(pkgs) != 2 {
+		t.Fatalf("Latest() produced %v packages instead of the expected %v", len(pkgs), 2)
+	}
+	if pkgs[0].ArtifactID != "barpy-1.0.tar.gz" || pkgs[0].Event != feeds.YankEvent {
+		t.Errorf("Latest() returned %s %s, want a yank of barpy-1.0.tar.gz", pkgs[0].ArtifactID, pkgs[0].Event)
+	}
+	if pkgs[1].ArtifactID != "barpy-1.1.tar.gz" || pkgs[1].Event != feeds.UnyankEvent {
+		t.Errorf("Latest() returned %s %s, want an unyank of barpy-1.1.tar.gz", pkgs[1].ArtifactID, pkgs[1].Event)
+	}
+}
+
+func TestPypiCriticalCursor(t *testing.T) {
+	t.Parallel()
+
+	var yanked atomic.Bool
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/pypi/barpy/json": func(w http.ResponseWriter, r *http.Request) {
+			if !yanked.Load() {
+				barpyProjectResponse(w, r)
+				return
+			}
+			_, err := w.Write([]byte(`{"info":{"name":"barpy"},"releases":{
+				"1.0":[{"filename":"barpy-1.0.tar.gz","upload_time_iso_8601":"2018-09-23T16:50:37.000000Z",
+					"yanked":true}],
+				"1.1":[{"filename":"barpy-1.1.tar.gz","upload_time_iso_8601":"2021-03-27T22:16:26.000000Z",
+					"yanked":true}]}}`))
+			if err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+	}
+	packages := []string{"barpy"}
+	srv := testutils.HTTPServerMock(handlers)
+
+	newFeed := func() *Feed {
+		feed, err := New(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+		if err != nil {
+			t.Fatalf("Failed to create pypi feed: %v", err)
+		}
+		feed.baseURL = srv.URL
+		return feed
+	}
+
+	feed := newFeed()
+	var _ feeds.CursorFeed = feed
+	cutoff := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, cutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("Failed to call Latest() with err: %v", errs[len(errs)-1])
+	}
+	cursor := feed.Cursor()
+
+	// A feed restored from the cursor detects the yank made while it was stopped.
+	yanked.Store(true)
+	restarted := newFeed()
+	restarted.SetCursor(cursor)
+	pkgs, _, errs := restarted.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("Failed to call Latest() with err: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].ArtifactID != "barpy-1.0.tar.gz" || pkgs[0].Event != feeds.YankEvent {
+		t.Fatalf("Latest() produced %v, want a yank of barpy-1.0.tar.gz", pkgs)
+	}
+
+	// Without the packages option the feed has no cursor.
+	firehose, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("Failed to create pypi feed: %v", err)
+	}
+	if firehose.Cursor() != "" {
+		t.Errorf("Cursor() = %q, want an empty cursor", firehose.Cursor())
 	}
 }
 
@@ -121,8 +523,8 @@ func TestPypiAllNotFound(t *testing.T) {
 	t.Parallel()
 
 	handlers := map[string]testutils.HTTPHandlerFunc{
-		"/rss/project/foopy/releases.xml": testutils.NotFoundHandlerFunc,
-		"/rss/project/barpy/releases.xml": testutils.NotFoundHandlerFunc,
+		"/pypi/foopy/json": testutils.NotFoundHandlerFunc,
+		"/pypi/barpy/json": testutils.NotFoundHandlerFunc,
 	}
 	packages := []string{
 		"foopy",
@@ -139,7 +541,7 @@ func TestPypiAllNotFound(t *testing.T) {
 	feed.baseURL = srv.URL
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	_, gotCutoff, errs := feed.Latest(cutoff)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if cutoff != gotCutoff {
 		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
 	}
@@ -155,8 +557,8 @@ func TestPypiCriticalPartialNotFound(t *testing.T) {
 	t.Parallel()
 
 	handlers := map[string]testutils.HTTPHandlerFunc{
-		"/rss/project/foopy/releases.xml": foopyReleasesResponse,
-		"/rss/project/barpy/releases.xml": testutils.NotFoundHandlerFunc,
+		"/pypi/foopy/json": foopyProjectResponse,
+		"/pypi/barpy/json": testutils.NotFoundHandlerFunc,
 	}
 	packages := []string{
 		"foopy",
@@ -173,7 +575,7 @@ func TestPypiCriticalPartialNotFound(t *testing.T) {
 	feed.baseURL = srv.URL
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, _, errs := feed.Latest(cutoff)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 1 {
 		t.Fatalf("feed.Latest() returned %v errors when 1 was expected", len(errs))
 	}
@@ -183,8 +585,8 @@ func TestPypiCriticalPartialNotFound(t *testing.T) {
 	if !strings.Contains(errs[len(errs)-1].Error(), "404") {
 		t.Fatalf("Failed to wrapped expected 404 error in feeds.PackagePollError, instead: %v", errs[len(errs)-1])
 	}
-	if len(pkgs) != 2 {
-		t.Fatalf("Latest() produced %v packages instead of the expected %v", len(pkgs), 2)
+	if len(pkgs) != 3 {
+		t.Fatalf("Latest() produced %v packages instead of the expected %v", len(pkgs), 3)
 	}
 }
 
@@ -220,29 +622,107 @@ func updatesXMLHandle(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+// Mock data for the newest projects on pypi.
+func newProjectsXMLHandle(w http.ResponseWriter, _ *http.Request) {
+	_, err := w.Write([]byte(`
+<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+	<channel>
+	<title>PyPI newest packages</title>
+	<link>https://pypi.org/</link>
+	<description>Newest packages registered at the Python Package Index</description>
+	<language>en</language>
+	<item>
+		<title>bazpy added to PyPI</title>
+		<link>https://pypi.org/project/bazpy/</link>
+		<description>Python wrapper for bazzing</description>
+		<pubDate>Fri, 19 Mar 2021 12:00:50 GMT</pubDate>
+	</item>
+	<item>
+		<title>BarPackage added to PyPI</title>
+		<link>https://pypi.org/project/BarPackage/</link>
+		<description>A package full of bars</description>
+		<pubDate>Fri, 19 Mar 2021 12:00:38 GMT</pubDate>
+	</item>
+	<item>
+		<title>FooPackage added to PyPI</title>
+		<link>https://pypi.org/project/FooPackage/</link>
+		<description>Python wrapper for fooing</description>
+		<pubDate>Thu, 18 Mar 2021 09:30:00 GMT</pubDate>
+	</item>
+	</channel>
+</rss>
+`))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
+// Mock data response for a new project whose first release is not in the updates.
+func bazpyProjectResponse(w http.ResponseWriter, _ *http.Request) {
+	_, err := w.Write([]byte(`
+{
+	"info": {"name": "bazpy", "version": "0.1.1"},
+	"releases": {
+		"0.1.0": [
+			{
+				"filename": "bazpy-0.1.0.tar.gz",
+				"upload_time_iso_8601": "2021-03-19T12:00:50.000000Z",
+				"yanked": false
+			}
+		],
+		"0.1.1": [
+			{
+				"filename": "bazpy-0.1.1.tar.gz",
+				"upload_time_iso_8601": "2021-03-19T12:00:55.000000Z",
+				"yanked": false
+			}
+		]
+	}
+}
+`))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
+
 // Mock data response for package specific api when pypi is configured with
 // a package list in FeedOptions.
-func foopyReleasesResponse(w http.ResponseWriter, _ *http.Request) {
+func foopyProjectResponse(w http.ResponseWriter, _ *http.Request) {
 	_, err := w.Write([]byte(`
-	<?xml version="1.0" encoding="UTF-8"?>
-	<rss version="2.0">
-	  <channel>
-		<title>PyPI recent updates for foopy</title>
-		<link>https://pypi.org/project/foopy/</link>
-		<description>Recent updates to the Python Package Index for foopy</description>
-		<language>en</language>
-		<item>
-		  <title>2.1</title>
-		  <link>https://pypi.org/project/foopy/2.1/</link>
-		  <pubDate>Sat, 27 Mar 2021 22:16:26 GMT</pubDate>
-		</item>
-		<item>
-		  <title>2.0</title>
-		  <link>https://pypi.org/project/foopy/2.0/</link>
-		  <pubDate>Sun, 23 Sep 2018 16:50:37 GMT</pubDate>
-		</item>
-	  </channel>
-	</rss>
+{
+	"info": {"name": "foopy", "version": "2.1"},
+	"releases": {
+		"2.0": [
+			{
+				"filename": "foopy-2.0.tar.gz",
+				"digests": {"sha256": "9a1f3c2e7d8b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c9b8a7f6e5d4c3b2a10"},
+				"requires_python": null,
+				"upload_time_iso_8601": "2018-09-23T16:50:37.000000Z",
+				"yanked": false,
+				"yanked_reason": null
+			}
+		],
+		"2.1": [
+			{
+				"filename": "foopy-2.1.tar.gz",
+				"digests": {"sha256": "5e4d3c2b1a0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e40"},
+				"requires_python": ">=3.7",
+				"upload_time_iso_8601": "2021-03-27T22:16:25.000000Z",
+				"yanked": false,
+				"yanked_reason": null
+			},
+			{
+				"filename": "foopy-2.1-py3-none-any.whl",
+				"digests": {"sha256": "3c8e1f2ad1e4ff2bd4e2b7a5c3b44f8c1a0d0f7e4b4c7f1e2e1d6c3b2a190807"},
+				"requires_python": ">=3.7",
+				"upload_time_iso_8601": "2021-03-27T22:16:26.000000Z",
+				"yanked": false,
+				"yanked_reason": null
+			}
+		]
+	}
+}
 `))
 	if err != nil {
 		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
@@ -250,28 +730,34 @@ func foopyReleasesResponse(w http.ResponseWriter, _ *http.Request) {
 }
 
 // Mock data response for package specific api when pypi is configured with
-// a package list in FeedOptions.
-func barpyReleasesResponse(w http.ResponseWriter, _ *http.Request) {
+// a package list in FeedOptions, barpy 1.1 has been yanked.
+func barpyProjectResponse(w http.ResponseWriter, _ *http.Request) {
 	_, err := w.Write([]byte(`
-	<?xml version="1.0" encoding="UTF-8"?>
-	<rss version="2.0">
-	  <channel>
-		<title>PyPI recent updates for barpy</title>
-		<link>https://pypi.org/project/barpy/</link>
-		<description>Recent updates to the Python Package Index for barpy</description>
-		<language>en</language>
-		<item>
-		  <title>1.1</title>
-		  <link>https://pypi.org/project/barpy/1.1/</link>
-		  <pubDate>Sat, 27 Mar 2021 22:16:26 GMT</pubDate>
-		</item>
-		<item>
-		  <title>1.0</title>
-		  <link>https://pypi.org/project/barpy/1.0/</link>
-		  <pubDate>Sun, 23 Sep 2018 16:50:37 GMT</pubDate>
-		</item>
-	  </channel>
-	</rss>
+{
+	"info": {"name": "barpy", "version": "1.0"},
+	"releases": {
+		"1.0": [
+			{
+				"filename": "barpy-1.0.tar.gz",
+				"digests": {"sha256": "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"},
+				"requires_python": null,
+				"upload_time_iso_8601": "2018-09-23T16:50:37.000000Z",
+				"yanked": false,
+				"yanked_reason": null
+			}
+		],
+		"1.1": [
+			{
+				"filename": "barpy-1.1.tar.gz",
+				"digests": {"sha256": "a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1"},
+				"requires_python": null,
+				"upload_time_iso_8601": "2021-03-27T22:16:26.000000Z",
+				"yanked": true,
+				"yanked_reason": "Broken build"
+			}
+		]
+	}
+}
 `))
 	if err != nil {
 		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
@@ -1,12 +1,17 @@
 package rubygems
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"sync"
 	"time"
 
+	log "github.com/sirupsen/logrus"
+
 	"github.com/ossf/package-feeds/pkg/events"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/useragent"
@@ -16,6 +21,7 @@ import (
 const (
 	FeedName     = "rubygems"
 	activityPath = "/api/v1/activity"
+	versionsPath = "/api/v1/versions"
 )
 
 var httpClient = &http.Client{
@@ -27,10 +33,23 @@ type Package struct {
 	Name        string    `json:"name"`
 	Version     string    `json:"version"`
 	CreatedDate time.Time `json:"version_created_at"`
+	SHA         string    `json:"sha"`
+}
+
+// Version is a version of a gem listed by the versions API, which only lists
+// versions which have not been yanked.
+type Version struct {
+	Number    string    `json:"number"`
+	CreatedAt time.Time `json:"created_at"`
+	SHA       string    `json:"sha"`
 }
 
-func fetchPackages(packagesURL string) ([]*Package, error) {
-	resp, err := httpClient.Get(packagesURL)
+func fetchPackages(ctx context.Context, packagesURL string) ([]*Package, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, packagesURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -46,28 +65,166 @@ func fetchPackages(packagesURL string) ([]*Package, error) {
 	return response, err
 }
 
+// fetchVersions returns the versions of a gem which have not been yanked.
+func fetchVersions(ctx context.Context, baseURL, gem string) ([]*Version, error) {
+	versionsURL, err := url.JoinPath(baseURL, versionsPath, gem+".json")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, versionsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = utils.CheckResponseStatus(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rubygems versions: %w", err)
+	}
+
+	versions := []*Version{}
+	err = json.NewDecoder(resp.Body).Decode(&versions)
+	return versions, err
+}
+
+func newPackage(created time.Time, name, version, sha string) *feeds.Package {
+	pkg := feeds.NewPackage(created, name, version, FeedName)
+	if sha != "" {
+		pkg.Checksum = "sha256:" + sha
+	}
+	return pkg
+}
+
 type Feed struct {
 	lossyFeedAlerter *feeds.LossyFeedAlerter
 	baseURL          string
+	packages         *[]string
 	options          feeds.FeedOptions
+
+	// mu guards known, which holds the versions of each gem listed by the
+	// previous poll when the packages option is set.
+	mu    sync.Mutex
+	known map[string]map[string]bool
 }
 
 func New(feedOptions feeds.FeedOptions, eventHandler *events.Handler) (*Feed, error) {
-	if feedOptions.Packages != nil {
-		return nil, feeds.UnsupportedOptionError{
-			Feed:   FeedName,
-			Option: "packages",
-		}
-	}
 	return &Feed{
 		lossyFeedAlerter: feeds.NewLossyFeedAlerter(eventHandler),
 		baseURL:          "https://rubygems.org",
+		packages:         feedOptions.Packages,
 		options:          feedOptions,
+		known:            map[string]map[string]bool{},
 	}, nil
 }
 
-func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+// diffVersions compares the versions of a gem with those listed by the previous
+// poll, returning the versions which were added along with yank events for the
+// versions which were removed. The first time a gem is polled, only the
+// versions created after the cutoff are returned.
+func (feed *Feed) diffVersions(
+	gem string, versions []*Version, cutoff time.Time,
+) ([]*feeds.Package, []*feeds.Package) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+
+	known, seen := feed.known[gem]
+	current := map[string]bool{}
+	releases := []*feeds.Package{}
+	for _, v := range versions {
+		// A version is listed once for each platform it was built for.
+		if current[v.Number] {
+			continue
+		}
+		current[v.Number] = true
+		if (seen && known[v.Number]) || (!seen && !v.CreatedAt.After(cutoff)) {
+			continue
+		}
+		releases = append(releases, newPackage(v.CreatedAt, gem, v.Number, v.SHA))
+	}
+	feed.known[gem] = current
+
+	// The versions API does not record when a version was yanked, so yanks are
+	// created at the time they were detected.
+	now := time.Now().UTC()
+	yanks := []*feeds.Package{}
+	for _, v := range sortedKeys(known) {
+		if !current[v] {
+			yanks = append(yanks, feeds.NewPackageEvent(now, gem, v, feeds.YankEvent, FeedName))
+		}
+	}
+	return releases, yanks
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fetchCriticalPackages polls the versions of each of the given gems concurrently,
+// returning the versions which were released along with the versions which were
+// yanked.
+func (feed *Feed) fetchCriticalPackages(
+	ctx context.Context, gems []string, cutoff time.Time,
+) ([]*feeds.Package, []*feeds.Package, []error) {
+	releases := []*feeds.Package{}
+	yanks := []*feeds.Package{}
+	errs := []error{}
+	versionsChannel := make(chan struct {
+		gem      string
+		versions []*Version
+	})
+	errChannel := make(chan error)
+
+	for _, gem := range gems {
+		go func(gem string) {
+			versions, err := fetchVersions(ctx, feed.baseURL, gem)
+			if err != nil {
+				errChannel <- feeds.PackagePollError{Name: gem, Err: err}
+				return
+			}
+			versionsChannel <- struct {
+				gem      string
+				versions []*Version
+			}{gem: gem, versions: versions}
+		}(gem)
+	}
+
+	for i := 0; i < len(gems); i++ {
+		select {
+		case r := <-versionsChannel:
+			gemReleases, gemYanks := feed.diffVersions(r.gem, r.versions, cutoff)
+			releases = append(releases, gemReleases...)
+			yanks = append(yanks, gemYanks...)
+		case err := <-errChannel:
+			errs = append(errs, err)
+		}
+	}
+	return releases, yanks, errs
+}
+
+func (feed *Feed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	if feed.packages != nil {
+		releases, yanks, errs := feed.fetchCriticalPackages(ctx, *feed.packages, cutoff)
+		if len(errs) == len(*feed.packages) && len(errs) != 0 {
+			// If none of the gems were successfully polled for, return early.
+			return nil, cutoff, append(errs, feeds.ErrNoPackagesPolled)
+		}
+		// Yanks are created at the time they were detected, so only releases move
+		// the cutoff.
+		return append(releases, yanks...), feeds.FindCutoff(cutoff, releases), errs
+	}
+
 	pkgs := []*feeds.Package{}
+	// Packages are keyed by name and version, so that every version of a gem
+	// released within the activity window is returned.
 	packages := make(map[string]*Package)
 	var errs []error
 
@@ -76,13 +233,13 @@ func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
 		// Failure to construct a url should lead to a hard failure.
 		return nil, cutoff, append(errs, err)
 	}
-	newPackages, err := fetchPackages(newPackagesURL)
+	newPackages, err := fetchPackages(ctx, newPackagesURL)
 	if err != nil {
 		// Updated Packages could still be processed.
 		errs = append(errs, err)
 	} else {
 		for _, pkg := range newPackages {
-			packages[pkg.Name] = pkg
+			packages[pkg.Name+"@"+pkg.Version] = pkg
 		}
 	}
 	updatedPackagesURL, err := url.JoinPath(feed.baseURL, activityPath, "just_updated.json")
@@ -90,31 +247,74 @@ func (feed Feed) Latest(cutoff time.Time) ([]*feeds.Package, time.Time, []error)
 		// Failure to construct a url should lead to a hard failure.
 		return nil, cutoff, append(errs, err)
 	}
-	updatedPackages, err := fetchPackages(updatedPackagesURL)
+	updatedPackages, err := fetchPackages(ctx, updatedPackagesURL)
 	if err != nil {
 		// New Packages could still be processed.
 		errs = append(errs, err)
 	} else {
 		for _, pkg := range updatedPackages {
-			packages[pkg.Name] = pkg
+			packages[pkg.Name+"@"+pkg.Version] = pkg
 		}
 	}
 
 	for _, pkg := range packages {
-		pkg := feeds.NewPackage(pkg.CreatedDate, pkg.Name, pkg.Version, FeedName)
-		pkgs = append(pkgs, pkg)
+		pkgs = append(pkgs, newPackage(pkg.CreatedDate, pkg.Name, pkg.Version, pkg.SHA))
 	}
-	feed.lossyFeedAlerter.ProcessPackages(FeedName, pkgs)
+	feed.lossyFeedAlerter.ProcessPackages(feed.options.InstanceName(FeedName), pkgs)
 
 	newCutoff := feeds.FindCutoff(cutoff, pkgs)
 	pkgs = feeds.ApplyCutoff(pkgs, cutoff)
 	return pkgs, newCutoff, errs
 }
 
-func (feed Feed) GetName() string {
+// Cursor returns the versions of each gem listed by the previous poll when the
+// packages option is set, so that yanks made while the feed is stopped are
+// detected after a restart.
+func (feed *Feed) Cursor() string {
+	if feed.packages == nil {
+		return ""
+	}
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	known := map[string][]string{}
+	for gem, versions := range feed.known {
+		known[gem] = sortedKeys(versions)
+	}
+	b, err := json.Marshal(known)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode rubygems cursor")
+		return ""
+	}
+	return string(b)
+}
+
+// SetCursor restores the versions of each gem listed by a previous poll. A
+// cursor which cannot be decoded is ignored, so that each gem is polled as if it
+// was not seen before.
+func (feed *Feed) SetCursor(cursor string) {
+	if feed.packages == nil || cursor == "" {
+		return
+	}
+	known := map[string][]string{}
+	if err := json.Unmarshal([]byte(cursor), &known); err != nil {
+		log.WithError(err).Warn("Ignoring invalid rubygems cursor")
+		return
+	}
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.known = map[string]map[string]bool{}
+	for gem, versions := range known {
+		feed.known[gem] = map[string]bool{}
+		for _, v := range versions {
+			feed.known[gem][v] = true
+		}
+	}
+}
+
+func (feed *Feed) GetName() string {
 	return FeedName
 }
 
-func (feed Feed) GetFeedOptions() feeds.FeedOptions {
+func (feed *Feed) GetFeedOptions() feeds.FeedOptions {
 	return feed.options
 }
@@ -1,8 +1,10 @@
 package rubygems
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -28,7 +30,7 @@ func TestRubyLatest(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, gotCutoff, errs := feed.Latest(cutoff)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 0 {
 		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
 	}
@@ -84,7 +86,7 @@ func TestRubyGemsNotFound(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	_, gotCutoff, errs := feed.Latest(cutoff)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
 	if cutoff != gotCutoff {
 		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
 	}
@@ -112,7 +114,7 @@ func TestRubyGemsPartialNotFound(t *testing.T) {
 	}
 
 	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	pkgs, _, errs := feed.Latest(cutoff)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
 	if len(errs) != 1 {
 		t.Fatalf("feed.Latest() returned %v errors when 1 was expected", len(errs))
 	}
@@ -126,6 +128,237 @@ func TestRubyGemsPartialNotFound(t *testing.T) {
 	}
 }
 
+func TestRubyGemsLatestMultipleVersions(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/api/v1/activity/latest.json":       rubyGemsPackagesResponse,
+		"/api/v1/activity/just_updated.json": rubyGemsUpdatedResponse,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	feed, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("failed to create new ruby feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	pkgs, _, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+
+	// Both versions of FooPackage are returned, along with BarPackage.
+	if len(pkgs) != 3 {
+		t.Fatalf("Latest() produced %v packages instead of the expected %v", len(pkgs), 3)
+	}
+	for _, pkg := range pkgs {
+		if pkg.Name == "FooPackage" && pkg.Version == "0.13.0" &&
+			pkg.Checksum != "sha256:8649253fb98b8ed0f733e2fc723b2435ead35cb1a70004ebff821abe7abaf131" {
+			t.Errorf("Unexpected checksum `%s` for FooPackage 0.13.0", pkg.Checksum)
+		}
+	}
+}
+
+func TestRubyGemsCriticalPackages(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/api/v1/versions/FooPackage.json": func(w http.ResponseWriter, _ *http.Request) {
+			// The second poll lists a new version, while 0.12.0 has been yanked.
+			versions := `[
+				{"number": "0.13.0", "created_at": "2021-03-19T13:00:43.260Z", "platform": "java"},
+				{"number": "0.13.0", "created_at": "2021-03-19T13:00:43.260Z", "platform": "ruby"},
+				{"number": "0.12.0", "created_at": "2021-03-18T09:12:01.000Z", "platform": "ruby"}
+			]`
+			if polls.Add(1) > 1 {
+				versions = `[
+					{"number": "0.14.0", "created_at": "2021-03-20T10:00:00.000Z", "platform": "ruby", "sha": "abc"},
+					{"number": "0.13.0", "created_at": "2021-03-19T13:00:43.260Z", "platform": "ruby"}
+				]`
+			}
+			if _, err := w.Write([]byte(versions)); err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+		"/api/v1/versions/BarPackage.json": testutils.NotFoundHandlerFunc,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	packages := []string{"FooPackage", "BarPackage"}
+	feed, err := New(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("failed to create new ruby feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 1 {
+		t.Fatalf("feed.Latest() returned %v errors when 1 was expected", len(errs))
+	}
+	if !errors.Is(errs[0], utils.ErrUnsuccessfulRequest) {
+		t.Fatalf("feed.Latest() returned an error which did not match the expected error")
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "0.13.0" {
+		t.Fatalf("Latest() produced %v, want only version 0.13.0", pkgs)
+	}
+	wantCutoff := time.Date(2021, 3, 19, 13, 0, 43, 260000000, time.UTC)
+	if !gotCutoff.Equal(wantCutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, wantCutoff)
+	}
+
+	pkgs, _, _ = feed.Latest(context.Background(), gotCutoff)
+	if len(pkgs) != 2 {
+		t.Fatalf("Latest() produced %v packages instead of the expected %v", len(pkgs), 2)
+	}
+	if pkgs[0].Version != "0.14.0" || pkgs[0].Event != "" || pkgs[0].Checksum != "sha256:abc" {
+		t.Errorf("Latest() returned %s %s, want the new version 0.14.0", pkgs[0].Version, pkgs[0].Event)
+	}
+	if pkgs[1].Version != "0.12.0" || pkgs[1].Event != feeds.YankEvent {
+		t.Errorf("Latest() returned %s %s, want a yank of 0.12.0", pkgs[1].Version, pkgs[1].Event)
+	}
+}
+
+func TestRubyGemsCriticalPackagesYankCutoff(t *testing.T) {
+	t.Parallel()
+
+	var polls atomic.Int32
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/api/v1/versions/FooPackage.json": func(w http.ResponseWriter, _ *http.Request) {
+			// The second poll only yanks 0.13.0.
+			versions := `[
+				{"number": "0.13.0", "created_at": "2021-03-19T13:00:43.260Z", "platform": "ruby"},
+				{"number": "0.12.0", "created_at": "2021-03-18T09:12:01.000Z", "platform": "ruby"}
+			]`
+			if polls.Add(1) > 1 {
+				versions = `[
+					{"number": "0.12.0", "created_at": "2021-03-18T09:12:01.000Z", "platform": "ruby"}
+				]`
+			}
+			if _, err := w.Write([]byte(versions)); err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	packages := []string{"FooPackage"}
+	feed, err := New(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("failed to create new ruby feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)
+	_, cutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+
+	// The yank is created when it was detected, which should not move the cutoff.
+	pkgs, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "0.13.0" || pkgs[0].Event != feeds.YankEvent {
+		t.Fatalf("Latest() produced %v, want a yank of 0.13.0", pkgs)
+	}
+	if !gotCutoff.Equal(cutoff) {
+		t.Errorf("Latest() cutoff %v, want %v", gotCutoff, cutoff)
+	}
+}
+
+func TestRubyGemsCriticalPackagesCursor(t *testing.T) {
+	t.Parallel()
+
+	var yanked atomic.Bool
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/api/v1/versions/FooPackage.json": func(w http.ResponseWriter, _ *http.Request) {
+			versions := `[
+				{"number": "0.13.0", "created_at": "2021-03-19T13:00:43.260Z", "platform": "ruby"},
+				{"number": "0.12.0", "created_at": "2021-03-18T09:12:01.000Z", "platform": "ruby"}
+			]`
+			if yanked.Load() {
+				versions = `[
+					{"number": "0.12.0", "created_at": "2021-03-18T09:12:01.000Z", "platform": "ruby"}
+				]`
+			}
+			if _, err := w.Write([]byte(versions)); err != nil {
+				http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+			}
+		},
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	packages := []string{"FooPackage"}
+	newFeed := func() *Feed {
+		feed, err := New(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+		if err != nil {
+			t.Fatalf("failed to create new ruby feed: %v", err)
+		}
+		feed.baseURL = srv.URL
+		return feed
+	}
+
+	feed := newFeed()
+	var _ feeds.CursorFeed = feed
+	cutoff := time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC)
+	_, cutoff, errs := feed.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	cursor := feed.Cursor()
+
+	// A feed restored from the cursor detects the yank made while it was stopped.
+	yanked.Store(true)
+	restarted := newFeed()
+	restarted.SetCursor(cursor)
+	pkgs, _, errs := restarted.Latest(context.Background(), cutoff)
+	if len(errs) != 0 {
+		t.Fatalf("feed.Latest returned error: %v", errs[len(errs)-1])
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "0.13.0" || pkgs[0].Event != feeds.YankEvent {
+		t.Fatalf("Latest() produced %v, want a yank of 0.13.0", pkgs)
+	}
+
+	// Without the packages option the feed has no cursor.
+	firehose, err := New(feeds.FeedOptions{}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("failed to create new ruby feed: %v", err)
+	}
+	if firehose.Cursor() != "" {
+		t.Errorf("Cursor() = %q, want an empty cursor", firehose.Cursor())
+	}
+}
+
+func TestRubyGemsCriticalPackagesNotFound(t *testing.T) {
+	t.Parallel()
+
+	handlers := map[string]testutils.HTTPHandlerFunc{
+		"/api/v1/versions/FooPackage.json": testutils.NotFoundHandlerFunc,
+	}
+	srv := testutils.HTTPServerMock(handlers)
+
+	packages := []string{"FooPackage"}
+	feed, err := New(feeds.FeedOptions{Packages: &packages}, events.NewNullHandler())
+	if err != nil {
+		t.Fatalf("failed to create new ruby feed: %v", err)
+	}
+	feed.baseURL = srv.URL
+
+	cutoff := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, gotCutoff, errs := feed.Latest(context.Background(), cutoff)
+	if cutoff != gotCutoff {
+		t.Error("feed.Latest() cutoff should be unchanged if an error is returned")
+	}
+	if !errors.Is(errs[len(errs)-1], feeds.ErrNoPackagesPolled) {
+		t.Fatalf("feed.Latest() returned an error which did not match the expected error")
+	}
+}
+
 func rubyGemsPackagesResponse(w http.ResponseWriter, _ *http.Request) {
 	_, err := w.Write([]byte(`
 [
@@ -188,3 +421,21 @@ func rubyGemsPackagesResponse(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
 	}
 }
+
+func rubyGemsUpdatedResponse(w http.ResponseWriter, _ *http.Request) {
+	_, err := w.Write([]byte(`
+[
+	{
+		"name": "FooPackage",
+		"version": "0.12.0",
+		"version_created_at": "2021-03-19T12:41:02.512Z",
+		"platform": "ruby",
+		"yanked": false,
+		"sha": "2ba1cd7a6bd60ca1e1c4eec0d6c8b81a3a1ae5b6e7d4aa1a9e0ee1bd3a0d1c2f"
+	}
+]
+`))
+	if err != nil {
+		http.Error(w, testutils.UnexpectedWriteError(err), http.StatusInternalServerError)
+	}
+}
@@ -44,3 +44,7 @@ func (pub *GCPPubSub) Send(ctx context.Context, body []byte) error {
 		Body: body,
 	})
 }
+
+func (pub *GCPPubSub) Close(ctx context.Context) error {
+	return pub.topic.Shutdown(ctx)
+}
@@ -35,10 +35,10 @@ func FromConfig(ctx context.Context, config Config) (*HTTPClientPubSub, error) {
 	return New(ctx, config.URL)
 }
 
-func (pub *HTTPClientPubSub) Send(_ context.Context, body []byte) error {
+func (pub *HTTPClientPubSub) Send(ctx context.Context, body []byte) error {
 	log.Info("Sending event to HTTP client publisher")
 	// Print the url to the log so that we can see where the event is being sent.
-	req, err := http.NewRequest("POST", pub.url, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pub.url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -58,3 +58,7 @@ func (pub *HTTPClientPubSub) Send(_ context.Context, body []byte) error {
 
 	return nil
 }
+
+func (pub *HTTPClientPubSub) Close(_ context.Context) error {
+	return nil
+}
@@ -45,3 +45,7 @@ func (pub *KafkaPubSub) Send(ctx context.Context, body []byte) error {
 		Body: body,
 	})
 }
+
+func (pub *KafkaPubSub) Close(ctx context.Context) error {
+	return pub.topic.Shutdown(ctx)
+}
@@ -7,4 +7,7 @@ import (
 type Publisher interface {
 	Send(ctx context.Context, body []byte) error
 	Name() string
+	// Close flushes any buffered messages and releases the resources held by
+	// the Publisher. Send must not be called after Close.
+	Close(ctx context.Context) error
 }
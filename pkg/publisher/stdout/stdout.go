@@ -23,3 +23,7 @@ func (pub *Stdout) Send(_ context.Context, body []byte) error {
 	fmt.Printf("%s\n", body)
 	return nil
 }
+
+func (pub *Stdout) Close(_ context.Context) error {
+	return nil
+}
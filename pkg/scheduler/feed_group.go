@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/ossf/package-feeds/pkg/checkpoint"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/publisher"
 )
@@ -15,29 +19,88 @@ import (
 var (
 	errPoll = errors.New("error when polling for packages")
 	errPub  = errors.New("error when publishing packages")
+
+	errMarshal = errors.New("error when marshaling package")
 )
 
 type feedEntry struct {
-	feed     feeds.ScheduledFeed
+	// name identifies the feed in logs, metrics, checkpoints and status, it is
+	// the name the feed is registered with in the scheduler.
+	name string
+	feed feeds.ScheduledFeed
+
+	// running is held whilst the feed is being polled and published, to avoid
+	// concurrent polls of the same feed from scheduled and on-demand polling.
+	running sync.Mutex
+
+	// mu guards lastPoll, cursor and the status of the most recent poll, which are
+	// read outside of polling when reporting metrics and status.
+	mu       sync.RWMutex
 	lastPoll time.Time
+	status   pollStatus
+
+	// cursor is the cursor of a feeds.CursorFeed up to which all packages have
+	// been published.
+	cursor string
+
+	// pending holds packages which failed to publish, to be retried after the
+	// next poll of the feed.
+	pending []*feeds.Package
+}
+
+func (f *feedEntry) cutoff() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.lastPoll
+}
+
+func (f *feedEntry) checkpoint() checkpoint.Checkpoint {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return checkpoint.Checkpoint{Cutoff: f.lastPoll, Cursor: f.cursor}
+}
+
+func (f *feedEntry) setCheckpoint(c checkpoint.Checkpoint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastPoll = c.Cutoff
+	f.cursor = c.Cursor
+}
+
+// feedCursor returns the current cursor of the feed, or an empty string if the
+// feed does not poll from a cursor.
+func (f *feedEntry) feedCursor() string {
+	if cf, ok := f.feed.(feeds.CursorFeed); ok {
+		return cf.Cursor()
+	}
+	return ""
 }
 
 type FeedGroup struct {
 	feeds         []*feedEntry
 	publisher     publisher.Publisher
+	store         checkpoint.Store
 	initialCutoff time.Time
+
+	// schedule is the cron schedule the group is polled on, this is empty if the
+	// group is only polled through HTTP requests.
+	schedule string
 }
 
 type groupResult struct {
+	numPolled    int
 	numPublished int
+	numSkipped   int
 	pollErr      error
 	pubErr       error
+	errs         []error
 }
 
 //nolint:lll
-func NewFeedGroup(scheduledFeeds []feeds.ScheduledFeed, pub publisher.Publisher, initialCutoff time.Duration) *FeedGroup {
+func NewFeedGroup(scheduledFeeds []feeds.ScheduledFeed, pub publisher.Publisher, store checkpoint.Store, initialCutoff time.Duration) *FeedGroup {
 	fg := &FeedGroup{
 		publisher:     pub,
+		store:         store,
 		initialCutoff: time.Now().UTC().Add(-initialCutoff),
 		feeds:         make([]*feedEntry, 0),
 	}
@@ -47,15 +110,59 @@ func NewFeedGroup(scheduledFeeds []feeds.ScheduledFeed, pub publisher.Publisher,
 	return fg
 }
 
+// AddFeed adds a feed to the group, identified by the name of the feed.
 func (fg *FeedGroup) AddFeed(feed feeds.ScheduledFeed) {
+	fg.AddNamedFeed(feed.GetName(), feed)
+}
+
+// AddNamedFeed adds a feed to the group, identified by name.
+func (fg *FeedGroup) AddNamedFeed(name string, feed feeds.ScheduledFeed) {
 	fg.feeds = append(fg.feeds, &feedEntry{
+		name:     name,
 		feed:     feed,
 		lastPoll: fg.initialCutoff,
 	})
 }
 
-func (fg *FeedGroup) Run() {
-	result := fg.pollAndPublish()
+// LoadCheckpoints replaces the initial cutoff of each feed with the cutoff saved
+// in the checkpoint store, for feeds which have a saved checkpoint.
+func (fg *FeedGroup) LoadCheckpoints(ctx context.Context) error {
+	for _, f := range fg.feeds {
+		c, err := fg.store.Load(ctx, f.name)
+		if errors.Is(err, checkpoint.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load checkpoint for %s feed: %w", f.name, err)
+		}
+		log.WithFields(log.Fields{
+			"feed":   f.name,
+			"cutoff": c.Cutoff,
+			"cursor": c.Cursor,
+		}).Print("Resuming feed from checkpoint")
+		f.setCheckpoint(c)
+		if cf, ok := f.feed.(feeds.CursorFeed); ok && c.Cursor != "" {
+			cf.SetCursor(c.Cursor)
+		}
+	}
+	return nil
+}
+
+// saveCheckpoint persists the current cutoff of a feed, failures are logged as
+// the feed can continue polling from the in-memory cutoff.
+func (fg *FeedGroup) saveCheckpoint(ctx context.Context, f *feedEntry) {
+	// The checkpoint is still saved if polling has been cancelled, as the cutoff
+	// reflects packages which have already been published.
+	ctx = context.WithoutCancel(ctx)
+	err := fg.store.Save(ctx, f.name, f.checkpoint())
+	if err != nil {
+		log.WithField("feed", f.name).WithError(err).Error("Failed to save checkpoint")
+	}
+}
+
+// Run polls and publishes the packages of each feed in the group, logging any errors.
+func (fg *FeedGroup) Run(ctx context.Context) {
+	result := fg.pollAndPublish(ctx)
 	if result.pollErr != nil {
 		log.Error(result.pollErr)
 	}
@@ -64,38 +171,100 @@ func (fg *FeedGroup) Run() {
 	}
 }
 
-func (fg *FeedGroup) pollAndPublish() groupResult {
+func (fg *FeedGroup) pollAndPublish(ctx context.Context) groupResult {
+	return fg.pollAndPublishFeeds(ctx, fg.feeds)
+}
+
+// pollAndPublishFeeds polls and publishes the given feeds of the group. Feeds which
+// are already being polled are skipped.
+func (fg *FeedGroup) pollAndPublishFeeds(ctx context.Context, entries []*feedEntry) groupResult {
 	result := groupResult{}
-	pkgs, err := fg.poll()
+	idle := make([]*feedEntry, 0, len(entries))
+	for _, f := range entries {
+		if !f.running.TryLock() {
+			log.WithField("feed", f.name).Warn("Skipping feed which is already being polled")
+			result.numSkipped++
+			continue
+		}
+		idle = append(idle, f)
+	}
+	defer func() {
+		for _, f := range idle {
+			f.running.Unlock()
+		}
+	}()
+
+	pollResults, err := fg.poll(ctx, idle)
 	result.pollErr = err
-	// Return early if no packages to process
-	if len(pkgs) == 0 {
-		return result
+
+	for _, r := range pollResults {
+		numPublished, err := fg.publishFeed(ctx, r)
+		result.numPolled += len(r.packages)
+		result.numPublished += numPublished
+		if err != nil {
+			result.pubErr = err
+		}
+		errs := r.errs
+		if err != nil {
+			errs = append(errs, err)
+		}
+		result.errs = append(result.errs, errs...)
+		r.entry.recordPoll(r.start, time.Now(), numPublished, errs)
 	}
-	log.WithField("num_packages", len(pkgs)).Printf("Publishing packages...")
-	result.numPublished, result.pubErr = fg.publishPackages(pkgs)
 	if result.numPublished > 0 {
 		log.WithField("num_packages", result.numPublished).Printf("Successfully published packages")
 	}
 	return result
 }
 
-// Poll fetches the latest packages from each registered feed.
-func (fg *FeedGroup) poll() ([]*feeds.Package, error) {
-	results := make(chan pollResult, len(fg.feeds))
-	for _, f := range fg.feeds {
+// publishFeed publishes the packages polled from a feed along with any packages
+// which previously failed to publish, then updates the feed's checkpoint.
+func (fg *FeedGroup) publishFeed(ctx context.Context, r pollResult) (int, error) {
+	f := r.entry
+	pkgs := mergePackages(f.pending, r.packages)
+	f.pending = nil
+	if len(pkgs) == 0 {
+		fg.updateCheckpoint(ctx, f, r.cutoff, f.feedCursor())
+		return 0, nil
+	}
+	logger := log.WithField("feed", r.name)
+	logger.WithField("num_packages", len(pkgs)).Printf("Publishing packages...")
+	numPublished, pending, err := fg.publishPackages(ctx, pkgs)
+	if len(pending) != 0 {
+		// Only move the cutoff up to the oldest package which failed to publish, so
+		// that it is polled again. The unpublished packages are also retried directly,
+		// as some feeds can no longer return them once they have been polled.
+		// The cursor is also left unchanged, so that a restart polls the unpublished
+		// packages again.
+		f.pending = pending
+		fg.updateCheckpoint(ctx, f, heldBackCutoff(f.cutoff(), r.cutoff, f.pending[0]), f.checkpoint().Cursor)
+		logger.WithField("num_packages", len(f.pending)).Error("Packages will be retried on the next poll")
+		return numPublished, err
+	}
+	fg.updateCheckpoint(ctx, f, r.cutoff, f.feedCursor())
+	return numPublished, err
+}
+
+// Poll fetches the latest packages from each of the given feeds. The cutoff of each
+// feed is left unchanged, the new cutoff is returned in the feed's pollResult.
+func (fg *FeedGroup) poll(ctx context.Context, entries []*feedEntry) ([]pollResult, error) {
+	results := make(chan pollResult, len(entries))
+	for _, f := range entries {
 		go func(f *feedEntry) {
 			result := pollResult{
-				name: f.feed.GetName(),
-				feed: f.feed,
+				name:  f.name,
+				entry: f,
 			}
-			result.packages, f.lastPoll, result.errs = f.feed.Latest(f.lastPoll)
+			result.start = time.Now()
+			result.packages, result.cutoff, result.errs = f.feed.Latest(ctx, f.cutoff())
+			recordPoll(result.name, time.Since(result.start), result.packages, result.errs)
 			results <- result
 		}(f)
 	}
 	errs := []error{}
-	packages := []*feeds.Package{}
-	for i := 0; i < len(fg.feeds); i++ {
+	pollResults := []pollResult{}
+	numPackages := 0
+	for i := 0; i < len(entries); i++ {
 		result := <-results
 
 		logger := log.WithField("feed", result.name)
@@ -110,7 +279,8 @@ func (fg *FeedGroup) poll() ([]*feeds.Package, error) {
 				"version": pkg.Version,
 			}).Print("Processing Package")
 		}
-		packages = append(packages, result.packages...)
+		pollResults = append(pollResults, result)
+		numPackages += len(result.packages)
 		logger.WithField("num_processed", len(result.packages)).Print("Packages successfully processed")
 	}
 	err := errPoll
@@ -118,14 +288,22 @@ func (fg *FeedGroup) poll() ([]*feeds.Package, error) {
 		err = nil
 	}
 
-	log.WithField("time", time.Now().UTC()).Printf("%d packages processed", len(packages))
-	return packages, err
+	log.WithField("time", time.Now().UTC()).Printf("%d packages processed", numPackages)
+	return pollResults, err
 }
 
-func (fg *FeedGroup) publishPackages(pkgs []*feeds.Package) (int, error) {
+// publishPackages publishes packages in order of creation, stopping at the first
+// package which fails to publish, returning the number of packages published
+// along with the packages from the first which failed to publish. Packages which
+// cannot be marshaled are dropped with an error rather than returned, as they can
+// never be published.
+func (fg *FeedGroup) publishPackages(ctx context.Context, pkgs []*feeds.Package) (int, []*feeds.Package, error) {
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		return pkgs[i].CreatedDate.Before(pkgs[j].CreatedDate)
+	})
 	processed := 0
-	errs := []error{}
-	for _, pkg := range pkgs {
+	var errs []error
+	for i, pkg := range pkgs {
 		log.WithFields(log.Fields{
 			"name":         pkg.Name,
 			"feed":         pkg.Type,
@@ -133,21 +311,78 @@ func (fg *FeedGroup) publishPackages(pkgs []*feeds.Package) (int, error) {
 		}).Print("Sending package upstream")
 		b, err := json.Marshal(pkg)
 		if err != nil {
-			log.WithField("name", pkg.Name).WithError(err).Error("Error marshaling package")
-			errs = append(errs, err)
+			log.WithField("name", pkg.Name).WithError(err).Error("Error marshaling package, it will not be published")
+			publishErrors.WithLabelValues(fg.publisher.Name()).Inc()
+			errs = append(errs, fmt.Errorf("%w %s: %w", errMarshal, pkg.Name, err))
+			continue
 		}
-		if err := (fg.publisher).Send(context.Background(), b); err != nil {
+		if err := (fg.publisher).Send(ctx, b); err != nil {
 			log.WithField("name", pkg.Name).WithError(err).Error("Error sending package to upstream publisher")
-			errs = append(errs, err)
+			publishErrors.WithLabelValues(fg.publisher.Name()).Inc()
+			log.Errorf("Failed to publish %v packages", len(pkgs)-i)
+			return processed, pkgs[i:], errors.Join(append(errs, errPub)...)
 		}
+		packagesPublished.WithLabelValues(fg.publisher.Name()).Inc()
 		processed++
 	}
-	err := errPub
-	if len(errs) == 0 {
-		err = nil
+	return processed, nil, errors.Join(errs...)
+}
+
+// updateCheckpoint sets the cutoff and cursor of a feed, saving a checkpoint if
+// either has changed.
+func (fg *FeedGroup) updateCheckpoint(ctx context.Context, f *feedEntry, cutoff time.Time, cursor string) {
+	c := f.checkpoint()
+	if cutoff.Equal(c.Cutoff) && cursor == c.Cursor {
+		return
+	}
+	f.setCheckpoint(checkpoint.Checkpoint{Cutoff: cutoff, Cursor: cursor})
+	fg.saveCheckpoint(ctx, f)
+}
+
+// heldBackCutoff returns the newest cutoff which will still include the oldest
+// unpublished package when the feed is next polled.
+func heldBackCutoff(lastPoll, cutoff time.Time, oldestUnpublished *feeds.Package) time.Time {
+	heldBack := oldestUnpublished.CreatedDate.Add(-time.Nanosecond)
+	if heldBack.After(cutoff) {
+		heldBack = cutoff
+	}
+	if heldBack.Before(lastPoll) {
+		return lastPoll
 	}
-	if len(pkgs)-processed != 0 {
-		log.Errorf("Failed to publish %v packages", len(pkgs)-processed)
+	return heldBack
+}
+
+type packageKey struct {
+	name       string
+	version    string
+	artifactID string
+	event      string
+	created    int64
+}
+
+// mergePackages combines packages retried from a previous poll with the results
+// of the latest poll, dropping any packages which were returned by both.
+func mergePackages(pending, pkgs []*feeds.Package) []*feeds.Package {
+	if len(pending) == 0 {
+		return pkgs
+	}
+	merged := make([]*feeds.Package, 0, len(pending)+len(pkgs))
+	seen := map[packageKey]bool{}
+	for _, list := range [][]*feeds.Package{pending, pkgs} {
+		for _, pkg := range list {
+			key := packageKey{
+				name:       pkg.Name,
+				version:    pkg.Version,
+				artifactID: pkg.ArtifactID,
+				event:      pkg.Event,
+				created:    pkg.CreatedDate.UnixNano(),
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, pkg)
+		}
 	}
-	return processed, err
+	return merged
 }
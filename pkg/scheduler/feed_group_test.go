@@ -1,10 +1,15 @@
 package scheduler
 
 import (
+	"context"
 	"errors"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+	"github.com/ossf/package-feeds/pkg/checkpoint/filestore"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/publisher"
 )
@@ -34,14 +39,14 @@ func TestFeedGroupPoll(t *testing.T) {
 	mockPub := mockPublisher{}
 	var pub publisher.Publisher = mockPub
 
-	feedGroup := NewFeedGroup(mockFeeds, pub, time.Minute)
+	feedGroup := NewFeedGroup(mockFeeds, pub, checkpoint.NewNullStore(), time.Minute)
 
-	pkgs, err := feedGroup.poll()
+	results, err := feedGroup.poll(context.Background(), feedGroup.feeds)
 	if err != nil {
 		t.Fatalf("Unexpected error arose during polling: %v", err)
 	}
-	if len(pkgs) != 4 {
-		t.Fatalf("poll() returned %v packages when 4 were expected", len(pkgs))
+	if numPackages := countPackages(results); numPackages != 4 {
+		t.Fatalf("poll() returned %v packages when 4 were expected", numPackages)
 	}
 }
 
@@ -63,17 +68,17 @@ func TestFeedGroupPollWithErr(t *testing.T) {
 	mockPub := mockPublisher{}
 	var pub publisher.Publisher = mockPub
 
-	feedGroup := NewFeedGroup(mockFeeds, pub, time.Minute)
+	feedGroup := NewFeedGroup(mockFeeds, pub, checkpoint.NewNullStore(), time.Minute)
 
-	pkgs, err := feedGroup.poll()
+	results, err := feedGroup.poll(context.Background(), feedGroup.feeds)
 	if err == nil {
 		t.Fatalf("Expected error during polling")
 	}
 	if !errors.Is(err, errPoll) {
 		t.Fatalf("Expected errPoll during polling")
 	}
-	if len(pkgs) != 2 {
-		t.Fatalf("Expected 2 packages alongside errors but found %v", len(pkgs))
+	if numPackages := countPackages(results); numPackages != 2 {
+		t.Fatalf("Expected 2 packages alongside errors but found %v", numPackages)
 	}
 }
 
@@ -93,8 +98,8 @@ func TestFeedGroupPublish(t *testing.T) {
 	}}
 	var pub publisher.Publisher = mockPub
 
-	feedGroup := NewFeedGroup(mockFeeds, pub, time.Minute)
-	numPublished, err := feedGroup.publishPackages(pkgs)
+	feedGroup := NewFeedGroup(mockFeeds, pub, checkpoint.NewNullStore(), time.Minute)
+	numPublished, _, err := feedGroup.publishPackages(context.Background(), pkgs)
 	if err != nil {
 		t.Fatalf("Unexpected error whilst publishing packages: %v", err)
 	}
@@ -117,8 +122,11 @@ func TestFeedGroupPublishWithErr(t *testing.T) {
 	}}
 	var pub publisher.Publisher = mockPub
 
-	feedGroup := NewFeedGroup(mockFeeds, pub, time.Minute)
-	_, err := feedGroup.publishPackages(pkgs)
+	feedGroup := NewFeedGroup(mockFeeds, pub, checkpoint.NewNullStore(), time.Minute)
+	_, pending, err := feedGroup.publishPackages(context.Background(), pkgs)
+	if len(pending) != len(pkgs) {
+		t.Fatalf("publishPackages returned %v pending packages, want %v", len(pending), len(pkgs))
+	}
 	if err == nil {
 		t.Fatalf("publishPackages provided no error when publishing produced an error")
 	}
@@ -126,3 +134,227 @@ func TestFeedGroupPublishWithErr(t *testing.T) {
 		t.Fatalf("Expected errPub during publishing")
 	}
 }
+
+func TestFeedGroupDropsUnmarshalablePackage(t *testing.T) {
+	t.Parallel()
+
+	initialCutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	newCutoff := initialCutoff.Add(2 * time.Minute)
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{
+			packages: []*feeds.Package{
+				// Years outside of [0,9999] cannot be marshaled.
+				{Name: "Foo", CreatedDate: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{Name: "Bar", CreatedDate: initialCutoff.Add(time.Minute)},
+			},
+			cutoff: newCutoff,
+		},
+	}
+	published := []string{}
+	mockPub := mockPublisher{sendCallback: func(msg string) error {
+		published = append(published, msg)
+		return nil
+	}}
+
+	feedGroup := NewFeedGroup(mockFeeds, mockPub, checkpoint.NewNullStore(), time.Minute)
+	feedGroup.feeds[0].lastPoll = initialCutoff
+
+	// The package which cannot be marshaled is dropped with an error, without
+	// holding back the cutoff.
+	result := feedGroup.pollAndPublish(context.Background())
+	if !errors.Is(result.pubErr, errMarshal) || errors.Is(result.pubErr, errPub) {
+		t.Fatalf("pollAndPublish returned %v, want only a marshaling error", result.pubErr)
+	}
+	if result.numPublished != 1 || len(published) != 1 || !strings.Contains(published[0], "Bar") {
+		t.Fatalf("pollAndPublish published %v, want only Bar", published)
+	}
+	if len(feedGroup.feeds[0].pending) != 0 {
+		t.Errorf("Feed has %v pending packages, want 0", len(feedGroup.feeds[0].pending))
+	}
+	if gotCutoff := feedGroup.feeds[0].lastPoll; !gotCutoff.Equal(newCutoff) {
+		t.Errorf("Cutoff was moved to %v, want %v", gotCutoff, newCutoff)
+	}
+}
+
+func TestFeedGroupCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	savedCutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	newCutoff := savedCutoff.Add(time.Hour)
+	store, err := filestore.New(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+	err = store.Save(context.Background(), "mockFeed", checkpoint.Checkpoint{Cutoff: savedCutoff})
+	if err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{
+			packages: []*feeds.Package{{Name: "Foo"}},
+			cutoff:   newCutoff,
+		},
+	}
+	feedGroup := NewFeedGroup(mockFeeds, mockPublisher{}, store, time.Minute)
+	if err := feedGroup.LoadCheckpoints(context.Background()); err != nil {
+		t.Fatalf("Failed to load checkpoints: %v", err)
+	}
+	if !feedGroup.feeds[0].lastPoll.Equal(savedCutoff) {
+		t.Fatalf("Feed cutoff %v was not loaded from the saved checkpoint %v", feedGroup.feeds[0].lastPoll, savedCutoff)
+	}
+
+	result := feedGroup.pollAndPublish(context.Background())
+	if result.pollErr != nil || result.pubErr != nil {
+		t.Fatalf("Unexpected error arose during polling: %v %v", result.pollErr, result.pubErr)
+	}
+	c, err := store.Load(context.Background(), "mockFeed")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint after polling: %v", err)
+	}
+	if !c.Cutoff.Equal(newCutoff) {
+		t.Errorf("Checkpoint cutoff %v was not updated to %v after polling", c.Cutoff, newCutoff)
+	}
+}
+
+func TestFeedGroupPublishFailureHoldsCutoff(t *testing.T) {
+	t.Parallel()
+
+	initialCutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	newCutoff := initialCutoff.Add(3 * time.Minute)
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{
+			packages: []*feeds.Package{
+				{Name: "Qux", CreatedDate: initialCutoff.Add(3 * time.Minute)},
+				{Name: "Foo", CreatedDate: initialCutoff.Add(time.Minute)},
+				{Name: "Bar", CreatedDate: initialCutoff.Add(2 * time.Minute)},
+			},
+			cutoff: newCutoff,
+		},
+	}
+
+	failing := true
+	published := []string{}
+	mockPub := mockPublisher{sendCallback: func(msg string) error {
+		if failing && strings.Contains(msg, "Bar") {
+			return errPublishing
+		}
+		published = append(published, msg)
+		return nil
+	}}
+
+	feedGroup := NewFeedGroup(mockFeeds, mockPub, checkpoint.NewNullStore(), time.Minute)
+	feedGroup.feeds[0].lastPoll = initialCutoff
+
+	result := feedGroup.pollAndPublish(context.Background())
+	if !errors.Is(result.pubErr, errPub) {
+		t.Fatalf("Expected errPub when publishing fails")
+	}
+	if result.numPublished != 1 {
+		t.Fatalf("Expected only the package older than the failure to be published, %v were published", result.numPublished)
+	}
+	wantCutoff := initialCutoff.Add(2 * time.Minute).Add(-time.Nanosecond)
+	if gotCutoff := feedGroup.feeds[0].lastPoll; !gotCutoff.Equal(wantCutoff) {
+		t.Fatalf("Cutoff was moved to %v, want %v", gotCutoff, wantCutoff)
+	}
+
+	// The next poll returns the same packages, which are merged with the pending Bar
+	// and Qux without duplicates. Foo was already published, but as the cutoff was
+	// held back it is polled and published again: publishing is at least once.
+	failing = false
+	result = feedGroup.pollAndPublish(context.Background())
+	if result.pubErr != nil {
+		t.Fatalf("Unexpected error whilst publishing packages: %v", result.pubErr)
+	}
+	if result.numPublished != 3 {
+		t.Fatalf("Expected 3 packages to be published on retry but %v were published", result.numPublished)
+	}
+	if gotCutoff := feedGroup.feeds[0].lastPoll; !gotCutoff.Equal(newCutoff) {
+		t.Errorf("Cutoff was moved to %v, want %v", gotCutoff, newCutoff)
+	}
+}
+
+func countPackages(results []pollResult) int {
+	n := 0
+	for _, r := range results {
+		n += len(r.packages)
+	}
+	return n
+}
+
+func TestFeedGroupSkipsFeedAlreadyPolling(t *testing.T) {
+	t.Parallel()
+
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{packages: []*feeds.Package{{Name: "Foo"}}},
+	}
+	feedGroup := NewFeedGroup(mockFeeds, mockPublisher{}, checkpoint.NewNullStore(), time.Minute)
+
+	feedGroup.feeds[0].running.Lock()
+	result := feedGroup.pollAndPublish(context.Background())
+	feedGroup.feeds[0].running.Unlock()
+	if result.numSkipped != 1 || result.numPublished != 0 {
+		t.Errorf("Poll of a busy feed skipped %v and published %v, want 1 and 0", result.numSkipped, result.numPublished)
+	}
+
+	result = feedGroup.pollAndPublish(context.Background())
+	if result.numSkipped != 0 || result.numPublished != 1 {
+		t.Errorf("Poll of an idle feed skipped %v and published %v, want 0 and 1", result.numSkipped, result.numPublished)
+	}
+}
+
+func TestFeedGroupCursorCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	store, err := filestore.New(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+	err = store.Save(context.Background(), "mockFeed", checkpoint.Checkpoint{Cursor: "10"})
+	if err != nil {
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+
+	cursor := ""
+	mockFeeds := []feeds.ScheduledFeed{
+		mockCursorFeed{
+			mockFeed: mockFeed{packages: []*feeds.Package{{Name: "Foo"}}},
+			cursor:   &cursor,
+			next:     "20",
+		},
+	}
+	failing := true
+	mockPub := mockPublisher{sendCallback: func(_ string) error {
+		if failing {
+			return errPublishing
+		}
+		return nil
+	}}
+	feedGroup := NewFeedGroup(mockFeeds, mockPub, store, time.Minute)
+	if err := feedGroup.LoadCheckpoints(context.Background()); err != nil {
+		t.Fatalf("Failed to load checkpoints: %v", err)
+	}
+	if cursor != "10" {
+		t.Fatalf("Feed cursor %q was not loaded from the saved checkpoint", cursor)
+	}
+
+	// The cursor is not saved until the polled packages have been published.
+	feedGroup.pollAndPublish(context.Background())
+	c, err := store.Load(context.Background(), "mockFeed")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint after polling: %v", err)
+	}
+	if c.Cursor != "10" {
+		t.Errorf("Checkpoint cursor %q was updated after publishing failed, want %q", c.Cursor, "10")
+	}
+
+	failing = false
+	feedGroup.pollAndPublish(context.Background())
+	c, err = store.Load(context.Background(), "mockFeed")
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint after polling: %v", err)
+	}
+	if c.Cursor != "20" {
+		t.Errorf("Checkpoint cursor %q was not updated to %q after publishing", c.Cursor, "20")
+	}
+}
@@ -14,14 +14,14 @@ func NewFeedGroupsHandler(feeds []*FeedGroup) *FeedGroupsHandler {
 	return &FeedGroupsHandler{feedGroups: feeds}
 }
 
-func (srv *FeedGroupsHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+func (srv *FeedGroupsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	resultChannel := make(chan groupResult, len(srv.feedGroups))
 	numPublished := 0
 	var pollErr, pubErr error
 	var errStrings []string
 	for _, group := range srv.feedGroups {
 		go func(group *FeedGroup) {
-			result := group.pollAndPublish()
+			result := group.pollAndPublish(r.Context())
 			resultChannel <- result
 		}(group)
 	}
@@ -51,3 +51,57 @@ func (srv *FeedGroupsHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request)
 		http.Error(w, "unexpected error during http server write: %w", http.StatusInternalServerError)
 	}
 }
+
+// FeedPollResult is the JSON response to polling a single feed on demand.
+type FeedPollResult struct {
+	Feed           string   `json:"feed"`
+	PackagesPolled int      `json:"packages_polled"`
+	Published      int      `json:"packages_published"`
+	Errors         []string `json:"errors"`
+}
+
+// FeedPollHandler polls a single feed on demand, regardless of the feed's schedule.
+type FeedPollHandler struct {
+	feedGroups []*FeedGroup
+}
+
+func NewFeedPollHandler(feedGroups []*FeedGroup) *FeedPollHandler {
+	return &FeedPollHandler{feedGroups: feedGroups}
+}
+
+func (h *FeedPollHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("feed")
+	for _, fg := range h.feedGroups {
+		for _, f := range fg.feeds {
+			if f.name != name {
+				continue
+			}
+			result := fg.pollAndPublishFeeds(r.Context(), []*feedEntry{f})
+			if result.numSkipped > 0 {
+				http.Error(w, "feed is already being polled: "+name, http.StatusConflict)
+				return
+			}
+			response := FeedPollResult{
+				Feed:           name,
+				PackagesPolled: result.numPolled,
+				Published:      result.numPublished,
+				Errors:         []string{},
+			}
+			for _, err := range result.errs {
+				response.Errors = append(response.Errors, err.Error())
+			}
+			statusCode := http.StatusOK
+			if len(response.Errors) > 0 {
+				statusCode = http.StatusInternalServerError
+			}
+			writeJSON(w, statusCode, response)
+			return
+		}
+	}
+	http.Error(w, "unknown feed: "+name, http.StatusNotFound)
+}
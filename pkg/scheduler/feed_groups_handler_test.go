@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+func newPollServer(feedGroups []*FeedGroup) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/", NewFeedGroupsHandler(feedGroups))
+	mux.Handle("/poll/{feed}", NewFeedPollHandler(feedGroups))
+	return httptest.NewServer(mux)
+}
+
+func TestFeedPollHandler(t *testing.T) {
+	t.Parallel()
+
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{
+			packages: []*feeds.Package{{Name: "Foo"}, {Name: "Bar"}},
+			errs:     []error{errPackage},
+			options:  feeds.FeedOptions{PollRate: "5m"},
+		},
+	}
+	feedGroup := NewFeedGroup(mockFeeds, mockPublisher{}, checkpoint.NewNullStore(), time.Minute)
+	feedGroup.schedule = "@every 5m"
+
+	srv := newPollServer([]*FeedGroup{feedGroup})
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/poll/mockFeed", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to poll feed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Poll returned status code %v, want %v", resp.StatusCode, http.StatusInternalServerError)
+	}
+	var result FeedPollResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode poll result: %v", err)
+	}
+	if result.Feed != "mockFeed" {
+		t.Errorf("Poll result feed %q, want %q", result.Feed, "mockFeed")
+	}
+	if result.PackagesPolled != 2 || result.Published != 2 {
+		t.Errorf("Poll result polled %v and published %v packages, want 2 and 2",
+			result.PackagesPolled, result.Published)
+	}
+	if len(result.Errors) != 1 || result.Errors[0] != errPackage.Error() {
+		t.Errorf("Poll result errors %v, want [%v]", result.Errors, errPackage)
+	}
+}
+
+func TestFeedPollHandlerMethodNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{
+			packages: []*feeds.Package{{Name: "Foo"}},
+		},
+	}
+	feedGroup := NewFeedGroup(mockFeeds, mockPublisher{}, checkpoint.NewNullStore(), time.Minute)
+
+	srv := newPollServer([]*FeedGroup{feedGroup})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/poll/mockFeed")
+	if err != nil {
+		t.Fatalf("Failed to poll feed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET returned status code %v, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+	if allow := resp.Header.Get("Allow"); allow != http.MethodPost {
+		t.Errorf("GET returned Allow header %q, want %q", allow, http.MethodPost)
+	}
+}
+
+func TestFeedPollHandlerUnknownFeed(t *testing.T) {
+	t.Parallel()
+
+	srv := newPollServer([]*FeedGroup{})
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/poll/foo", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to poll feed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unknown feed returned status code %v, want %v", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestFeedPollHandlerFeedAlreadyPolling(t *testing.T) {
+	t.Parallel()
+
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{packages: []*feeds.Package{{Name: "Foo"}}},
+	}
+	feedGroup := NewFeedGroup(mockFeeds, mockPublisher{}, checkpoint.NewNullStore(), time.Minute)
+
+	srv := newPollServer([]*FeedGroup{feedGroup})
+	defer srv.Close()
+
+	feedGroup.feeds[0].running.Lock()
+	defer feedGroup.feeds[0].running.Unlock()
+
+	resp, err := http.Post(srv.URL+"/poll/mockFeed", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to poll feed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Polling a busy feed returned status code %v, want %v", resp.StatusCode, http.StatusConflict)
+	}
+}
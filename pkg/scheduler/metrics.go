@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+const metricsNamespace = "package_feeds"
+
+var (
+	pollDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "poll_duration_seconds",
+		Help:      "Time taken to poll a feed for the latest packages.",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 10),
+	}, []string{"feed"})
+
+	packagesPolled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "packages_polled_total",
+		Help:      "Number of packages returned by polling a feed.",
+	}, []string{"feed"})
+
+	pollErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "poll_errors_total",
+		Help: "Number of errors returned by polling a feed, by type of error and the HTTP status " +
+			"code of unsuccessful requests.",
+	}, []string{"feed", "type", "http_status"})
+
+	packagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "packages_published_total",
+		Help:      "Number of packages successfully sent to a publisher.",
+	}, []string{"publisher"})
+
+	publishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "publish_errors_total",
+		Help:      "Number of packages which failed to be sent to a publisher.",
+	}, []string{"publisher"})
+
+	cutoffLagDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "feed_cutoff_lag_seconds"),
+		"Time since the cutoff of a feed, this grows when a feed stops returning packages.",
+		[]string{"feed"}, nil,
+	)
+)
+
+// Error types used for the "type" label of poll errors.
+const (
+	pollErrorTypeNoPackages  = "no_packages_polled"
+	pollErrorTypePackagePoll = "package_poll"
+	pollErrorTypeOther       = "other"
+)
+
+func recordPoll(feed string, duration time.Duration, pkgs []*feeds.Package, errs []error) {
+	pollDuration.WithLabelValues(feed).Observe(duration.Seconds())
+	packagesPolled.WithLabelValues(feed).Add(float64(len(pkgs)))
+	for _, err := range errs {
+		errType, status := classifyPollError(err)
+		pollErrors.WithLabelValues(feed, errType, status).Inc()
+	}
+}
+
+// classifyPollError returns the type of a poll error and the HTTP status code of
+// the failed request, if the error was caused by an unsuccessful request.
+func classifyPollError(err error) (string, string) {
+	errType := pollErrorTypeOther
+	var pollErr feeds.PackagePollError
+	switch {
+	case errors.Is(err, feeds.ErrNoPackagesPolled):
+		errType = pollErrorTypeNoPackages
+	case errors.As(err, &pollErr):
+		errType = pollErrorTypePackagePoll
+	}
+
+	status := ""
+	var requestErr utils.UnsuccessfulRequestError
+	if errors.As(err, &requestErr) {
+		status = strconv.Itoa(requestErr.StatusCode)
+	}
+	return errType, status
+}
+
+// cutoffCollector reports the lag of each feed's cutoff at the time of collection.
+type cutoffCollector struct {
+	feedGroups []*FeedGroup
+}
+
+func newCutoffCollector(feedGroups []*FeedGroup) *cutoffCollector {
+	return &cutoffCollector{feedGroups: feedGroups}
+}
+
+func (c *cutoffCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cutoffLagDesc
+}
+
+func (c *cutoffCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, fg := range c.feedGroups {
+		for _, f := range fg.feeds {
+			ch <- prometheus.MustNewConstMetric(cutoffLagDesc, prometheus.GaugeValue,
+				time.Since(f.cutoff()).Seconds(), f.name)
+		}
+	}
+}
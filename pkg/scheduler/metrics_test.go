@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+	"github.com/ossf/package-feeds/pkg/feeds"
+	"github.com/ossf/package-feeds/pkg/utils"
+)
+
+func TestClassifyPollError(t *testing.T) {
+	t.Parallel()
+
+	notFound := utils.UnsuccessfulRequestError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+	tests := []struct {
+		name       string
+		err        error
+		wantType   string
+		wantStatus string
+	}{
+		{
+			name:     "no packages polled",
+			err:      feeds.ErrNoPackagesPolled,
+			wantType: pollErrorTypeNoPackages,
+		},
+		{
+			name:       "package poll error with unsuccessful request",
+			err:        feeds.PackagePollError{Name: "foo", Err: notFound},
+			wantType:   pollErrorTypePackagePoll,
+			wantStatus: "404",
+		},
+		{
+			name:       "wrapped unsuccessful request",
+			err:        fmt.Errorf("failed to fetch package data: %w", notFound),
+			wantType:   pollErrorTypeOther,
+			wantStatus: "404",
+		},
+		{
+			name:     "other error",
+			err:      errPackage,
+			wantType: pollErrorTypeOther,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotType, gotStatus := classifyPollError(test.err)
+			if gotType != test.wantType {
+				t.Errorf("classifyPollError() type = %q, want %q", gotType, test.wantType)
+			}
+			if gotStatus != test.wantStatus {
+				t.Errorf("classifyPollError() status = %q, want %q", gotStatus, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCutoffCollector(t *testing.T) {
+	t.Parallel()
+
+	mockFeeds := []feeds.ScheduledFeed{mockFeed{}}
+	feedGroup := NewFeedGroup(mockFeeds, mockPublisher{}, checkpoint.NewNullStore(), time.Hour)
+
+	collector := newCutoffCollector([]*FeedGroup{feedGroup})
+	if n := testutil.CollectAndCount(collector); n != 1 {
+		t.Fatalf("Collected %v cutoff lag metrics when 1 was expected", n)
+	}
+	if lag := testutil.ToFloat64(collector); lag < time.Hour.Seconds() {
+		t.Errorf("Cutoff lag %vs is less than the initial cutoff of 1h", lag)
+	}
+}
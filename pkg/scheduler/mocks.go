@@ -23,7 +23,7 @@ func (feed mockFeed) GetFeedOptions() feeds.FeedOptions {
 	return feed.options
 }
 
-func (feed mockFeed) Latest(_ time.Time) ([]*feeds.Package, time.Time, []error) {
+func (feed mockFeed) Latest(_ context.Context, _ time.Time) ([]*feeds.Package, time.Time, []error) {
 	return feed.packages, feed.cutoff, feed.errs
 }
 
@@ -41,3 +41,27 @@ func (pub mockPublisher) Send(_ context.Context, body []byte) error {
 func (pub mockPublisher) Name() string {
 	return "mockPublisher"
 }
+
+func (pub mockPublisher) Close(_ context.Context) error {
+	return nil
+}
+
+// mockCursorFeed advances its cursor to next each time it is polled.
+type mockCursorFeed struct {
+	mockFeed
+	cursor *string
+	next   string
+}
+
+func (feed mockCursorFeed) Latest(ctx context.Context, cutoff time.Time) ([]*feeds.Package, time.Time, []error) {
+	*feed.cursor = feed.next
+	return feed.mockFeed.Latest(ctx, cutoff)
+}
+
+func (feed mockCursorFeed) Cursor() string {
+	return *feed.cursor
+}
+
+func (feed mockCursorFeed) SetCursor(cursor string) {
+	*feed.cursor = cursor
+}
@@ -1,40 +1,58 @@
 package scheduler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/ossf/package-feeds/pkg/checkpoint"
 	"github.com/ossf/package-feeds/pkg/feeds"
 	"github.com/ossf/package-feeds/pkg/publisher"
 )
 
+// shutdownTimeout bounds how long in-flight polls are given to complete when the
+// scheduler is stopped, it is kept below the default Kubernetes termination grace
+// period of 30s.
+const shutdownTimeout = 25 * time.Second
+
 // Scheduler is a registry of feeds that should be run on a schedule.
 type Scheduler struct {
 	registry  map[string]feeds.ScheduledFeed
 	publisher publisher.Publisher
+	store     checkpoint.Store
 	httpPort  int
 }
 
-// New returns a new Scheduler with a publisher and feeds configured for polling.
-func New(feedsMap map[string]feeds.ScheduledFeed, pub publisher.Publisher, httpPort int) *Scheduler {
+// New returns a new Scheduler with a publisher and feeds configured for polling,
+// the cutoff of each feed is persisted to the given checkpoint store. Feeds are
+// identified by their key in feedsMap.
+//
+//nolint:lll
+func New(feedsMap map[string]feeds.ScheduledFeed, pub publisher.Publisher, store checkpoint.Store, httpPort int) *Scheduler {
 	return &Scheduler{
 		registry:  feedsMap,
 		publisher: pub,
+		store:     store,
 		httpPort:  httpPort,
 	}
 }
 
 type pollResult struct {
 	name     string
-	feed     feeds.ScheduledFeed
+	entry    *feedEntry
 	packages []*feeds.Package
+	cutoff   time.Time
 	errs     []error
+	start    time.Time
 }
 
 // healthCheckHandler is a simple health check handler for the HTTP server.
@@ -69,19 +87,33 @@ func healthCheckHandler(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
-// Runs several services for the operation of scheduler, this call is blocking until application exit
-// or failure in the HTTP server
+// Runs several services for the operation of scheduler, this call is blocking until ctx is
+// cancelled or failure in the HTTP server
 // Services include: Cron polling via FeedGroups, HTTP serving of FeedGroupsHandler.
-func (s *Scheduler) Run(initialCutoff time.Duration, enableDefaultTimer bool) error {
+// When ctx is cancelled no further polls are started and in-flight polls are given
+// shutdownTimeout to complete before they are cancelled.
+func (s *Scheduler) Run(ctx context.Context, initialCutoff time.Duration, enableDefaultTimer bool) error {
 	defaultSchedule := fmt.Sprintf("@every %s", initialCutoff.String())
 
-	schedules, err := buildSchedules(s.registry, s.publisher, initialCutoff)
+	schedules, err := buildSchedules(s.registry, s.publisher, s.store, initialCutoff)
 	if err != nil {
 		return err
 	}
+	allGroups := make([]*FeedGroup, 0, len(schedules))
+	for _, feedGroup := range schedules {
+		if err := feedGroup.LoadCheckpoints(ctx); err != nil {
+			return err
+		}
+		allGroups = append(allGroups, feedGroup)
+	}
 	var feedGroups []*FeedGroup
 	var pollFeedNames []string
 
+	// Polls run with a context which outlives ctx, allowing in-flight polls to
+	// complete during shutdown.
+	pollCtx, cancelPolls := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelPolls()
+
 	// Configure cron job for scheduled polling.
 	cronJob := cron.New(
 		cron.WithLogger(cron.PrintfLogger(log.StandardLogger())),
@@ -91,7 +123,7 @@ func (s *Scheduler) Run(initialCutoff time.Duration, enableDefaultTimer bool) er
 	for schedule, feedGroup := range schedules {
 		var feedNames []string
 		for _, f := range feedGroup.feeds {
-			feedNames = append(feedNames, f.feed.GetName())
+			feedNames = append(feedNames, f.name)
 		}
 
 		if schedule == "" {
@@ -106,10 +138,13 @@ func (s *Scheduler) Run(initialCutoff time.Duration, enableDefaultTimer bool) er
 			// Undefined schedules will follow the default schedule, if the default timer is enabled.
 			schedule = defaultSchedule
 		}
+		feedGroup.schedule = schedule
 
 		_, err := cronJob.AddJob(schedule, cron.NewChain(
 			cron.SkipIfStillRunning(cron.VerbosePrintfLogger(log.StandardLogger())),
-		).Then(feedGroup))
+		).Then(cron.FuncJob(func() {
+			feedGroup.Run(pollCtx)
+		})))
 		if err != nil {
 			return fmt.Errorf("failed to parse schedule `%s`: %w", schedule, err)
 		}
@@ -121,19 +156,60 @@ func (s *Scheduler) Run(initialCutoff time.Duration, enableDefaultTimer bool) er
 	// Start http server for polling via HTTP requests
 	pollServer := NewFeedGroupsHandler(feedGroups)
 	log.Infof("Listening on port %v for %s", s.httpPort, strings.Join(pollFeedNames, ", "))
-	http.Handle("/", pollServer)
-	http.HandleFunc("/health", healthCheckHandler)
+	mux := http.NewServeMux()
+	mux.Handle("/", pollServer)
+	mux.HandleFunc("/health", healthCheckHandler)
+
+	statusHandler := NewFeedStatusHandler(allGroups)
+	mux.HandleFunc("GET /feeds", statusHandler.ListFeeds)
+	mux.HandleFunc("GET /feeds/{name}", statusHandler.GetFeed)
+	// Polling a single feed is registered for all methods, so that other methods
+	// are rejected rather than falling through to polling every feed.
+	mux.Handle("/poll/{feed}", NewFeedPollHandler(allGroups))
+
+	// Serve metrics from the default registry alongside the cutoff lag of this
+	// scheduler's feeds.
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newCutoffCollector(allGroups))
+	mux.Handle("/metrics", promhttp.HandlerFor(
+		prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{}))
 
 	server := &http.Server{
-		Addr: fmt.Sprintf(":%v", s.httpPort),
+		Addr:    fmt.Sprintf(":%v", s.httpPort),
+		Handler: mux,
 		// default 60s timeout used from nginx
 		// https://medium.com/a-journey-with-go/go-understand-and-mitigate-slowloris-attack-711c1b1403f6
 		ReadHeaderTimeout: 60 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return pollCtx
+		},
 	}
-	if err := server.ListenAndServe(); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		<-cronJob.Stop().Done()
 		return err
+	case <-ctx.Done():
 	}
 
+	log.Info("Shutting down, waiting for in-flight polls to complete")
+	shutdownCtx, cancel := context.WithTimeout(pollCtx, shutdownTimeout)
+	defer cancel()
+	cronDone := cronJob.Stop()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Error("Failed to drain HTTP polls before shutdown")
+	}
+	select {
+	case <-cronDone.Done():
+	case <-shutdownCtx.Done():
+		log.Error("Timed out waiting for scheduled polls, cancelling in-flight polls")
+		cancelPolls()
+		<-cronDone.Done()
+	}
 	return nil
 }
 
@@ -141,9 +217,9 @@ func (s *Scheduler) Run(initialCutoff time.Duration, enableDefaultTimer bool) er
 // The resulting map may have index "" with a FeedGroup of feeds without a schedule option configured.
 //
 //nolint:lll
-func buildSchedules(registry map[string]feeds.ScheduledFeed, pub publisher.Publisher, initialCutoff time.Duration) (map[string]*FeedGroup, error) {
+func buildSchedules(registry map[string]feeds.ScheduledFeed, pub publisher.Publisher, store checkpoint.Store, initialCutoff time.Duration) (map[string]*FeedGroup, error) {
 	schedules := map[string]*FeedGroup{}
-	for _, feed := range registry {
+	for name, feed := range registry {
 		options := feed.GetFeedOptions()
 
 		pollRate := options.PollRate
@@ -161,9 +237,9 @@ func buildSchedules(registry map[string]feeds.ScheduledFeed, pub publisher.Publi
 
 		// Initialize new schedules in map.
 		if _, ok := schedules[schedule]; !ok {
-			schedules[schedule] = NewFeedGroup([]feeds.ScheduledFeed{}, pub, cutoff)
+			schedules[schedule] = NewFeedGroup([]feeds.ScheduledFeed{}, pub, store, cutoff)
 		}
-		schedules[schedule].AddFeed(feed)
+		schedules[schedule].AddNamedFeed(name, feed)
 	}
 	return schedules, nil
 }
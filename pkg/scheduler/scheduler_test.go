@@ -1,9 +1,11 @@
 package scheduler
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/ossf/package-feeds/pkg/checkpoint"
 	"github.com/ossf/package-feeds/pkg/feeds"
 )
 
@@ -37,7 +39,7 @@ func TestBuildSchedules(t *testing.T) {
 	}
 	cutoff := time.Minute
 	pub := mockPublisher{}
-	schedules, err := buildSchedules(scheduledFeeds, pub, cutoff)
+	schedules, err := buildSchedules(scheduledFeeds, pub, checkpoint.NewNullStore(), cutoff)
 	if err != nil {
 		t.Fatalf("Failed to build schedules: %v", err)
 	}
@@ -64,4 +66,35 @@ func TestBuildSchedules(t *testing.T) {
 	if len(thirtySecFg.feeds) != 2 {
 		t.Fatalf("30s schedule contained %v feeds when %v was expected.", len(thirtySecFg.feeds), 2)
 	}
+	// Feeds are identified by their name in the registry rather than the feed's own name.
+	if twentySecFg.feeds[0].name != "Baz" {
+		t.Errorf("20s schedule contained feed %q when %q was expected.", twentySecFg.feeds[0].name, "Baz")
+	}
+}
+
+func TestRunStopsWhenContextCancelled(t *testing.T) {
+	t.Parallel()
+
+	scheduledFeeds := map[string]feeds.ScheduledFeed{
+		"Foo": mockFeed{
+			options: feeds.FeedOptions{PollRate: "1h"},
+		},
+	}
+	sched := New(scheduledFeeds, mockPublisher{}, checkpoint.NewNullStore(), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- sched.Run(ctx, time.Minute, false)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() returned an error on shutdown: %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("Run() did not return after its context was cancelled")
+	}
 }
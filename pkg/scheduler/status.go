@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+// pollStatus records the outcome of the most recent poll of a feed.
+type pollStatus struct {
+	start          time.Time
+	end            time.Time
+	numPublished   int
+	totalPublished int
+	errs           []string
+}
+
+// FeedStatus describes a registered feed, its schedule and its most recent poll.
+type FeedStatus struct {
+	Name    string            `json:"name"`
+	Options feeds.FeedOptions `json:"options"`
+	// Schedule is the cron schedule of the feed, this is empty for feeds which
+	// are only polled through HTTP requests.
+	Schedule      string     `json:"schedule"`
+	Cutoff        time.Time  `json:"cutoff"`
+	Cursor        string     `json:"cursor,omitempty"`
+	LastPollStart *time.Time `json:"last_poll_start,omitempty"`
+	LastPollEnd   *time.Time `json:"last_poll_end,omitempty"`
+	// PackagesPublished is the number of packages published by the most recent
+	// poll, TotalPublished is the number published since startup.
+	PackagesPublished int      `json:"packages_published"`
+	TotalPublished    int      `json:"total_published"`
+	LastErrors        []string `json:"last_errors"`
+}
+
+func (f *feedEntry) recordPoll(start, end time.Time, numPublished int, errs []error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status.start = start
+	f.status.end = end
+	f.status.numPublished = numPublished
+	f.status.totalPublished += numPublished
+	f.status.errs = make([]string, 0, len(errs))
+	for _, err := range errs {
+		f.status.errs = append(f.status.errs, err.Error())
+	}
+}
+
+func (f *feedEntry) getStatus(schedule string) FeedStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	status := FeedStatus{
+		Name:              f.name,
+		Options:           f.feed.GetFeedOptions(),
+		Schedule:          schedule,
+		Cutoff:            f.lastPoll,
+		Cursor:            f.cursor,
+		PackagesPublished: f.status.numPublished,
+		TotalPublished:    f.status.totalPublished,
+		LastErrors:        append([]string{}, f.status.errs...),
+	}
+	if !f.status.start.IsZero() {
+		start, end := f.status.start, f.status.end
+		status.LastPollStart = &start
+		status.LastPollEnd = &end
+	}
+	return status
+}
+
+// FeedStatusHandler serves the status of each feed as JSON.
+type FeedStatusHandler struct {
+	feedGroups []*FeedGroup
+}
+
+func NewFeedStatusHandler(feedGroups []*FeedGroup) *FeedStatusHandler {
+	return &FeedStatusHandler{feedGroups: feedGroups}
+}
+
+// ListFeeds writes the status of every registered feed.
+func (h *FeedStatusHandler) ListFeeds(w http.ResponseWriter, _ *http.Request) {
+	statuses := []FeedStatus{}
+	for _, fg := range h.feedGroups {
+		for _, f := range fg.feeds {
+			statuses = append(statuses, f.getStatus(fg.schedule))
+		}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// GetFeed writes the status of the feed named in the request path.
+func (h *FeedStatusHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	for _, fg := range h.feedGroups {
+		for _, f := range fg.feeds {
+			if f.name == name {
+				writeJSON(w, http.StatusOK, f.getStatus(fg.schedule))
+				return
+			}
+		}
+	}
+	http.Error(w, "unknown feed: "+name, http.StatusNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("Failed to marshal response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Errorf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ossf/package-feeds/pkg/checkpoint"
+	"github.com/ossf/package-feeds/pkg/feeds"
+)
+
+func newStatusServer(feedGroups []*FeedGroup) *httptest.Server {
+	statusHandler := NewFeedStatusHandler(feedGroups)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /feeds", statusHandler.ListFeeds)
+	mux.HandleFunc("GET /feeds/{name}", statusHandler.GetFeed)
+	return httptest.NewServer(mux)
+}
+
+func TestFeedStatusHandler(t *testing.T) {
+	t.Parallel()
+
+	cutoff := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockFeeds := []feeds.ScheduledFeed{
+		mockFeed{
+			packages: []*feeds.Package{{Name: "Foo"}, {Name: "Bar"}},
+			errs:     []error{errPackage},
+			cutoff:   cutoff,
+			options:  feeds.FeedOptions{PollRate: "5m"},
+		},
+	}
+	feedGroup := NewFeedGroup(mockFeeds, mockPublisher{}, checkpoint.NewNullStore(), time.Minute)
+	feedGroup.schedule = "@every 5m"
+	feedGroup.pollAndPublish(context.Background())
+
+	srv := newStatusServer([]*FeedGroup{feedGroup})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/feeds/mockFeed")
+	if err != nil {
+		t.Fatalf("Failed to request feed status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Feed status returned status code %v", resp.StatusCode)
+	}
+	var status FeedStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode feed status: %v", err)
+	}
+
+	if status.Name != "mockFeed" {
+		t.Errorf("Feed status name %q, want %q", status.Name, "mockFeed")
+	}
+	if status.Schedule != "@every 5m" {
+		t.Errorf("Feed status schedule %q, want %q", status.Schedule, "@every 5m")
+	}
+	if status.Options.PollRate != "5m" {
+		t.Errorf("Feed status poll rate %q, want %q", status.Options.PollRate, "5m")
+	}
+	if !status.Cutoff.Equal(cutoff) {
+		t.Errorf("Feed status cutoff %v, want %v", status.Cutoff, cutoff)
+	}
+	if status.LastPollStart == nil || status.LastPollEnd == nil {
+		t.Errorf("Feed status is missing the last poll times")
+	}
+	if status.PackagesPublished != 2 {
+		t.Errorf("Feed status reported %v packages published, want 2", status.PackagesPublished)
+	}
+	if len(status.LastErrors) != 1 || status.LastErrors[0] != errPackage.Error() {
+		t.Errorf("Feed status errors %v, want [%v]", status.LastErrors, errPackage)
+	}
+}
+
+func TestFeedStatusHandlerUnknownFeed(t *testing.T) {
+	t.Parallel()
+
+	srv := newStatusServer([]*FeedGroup{})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/feeds/foo")
+	if err != nil {
+		t.Fatalf("Failed to request feed status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Unknown feed returned status code %v, want %v", resp.StatusCode, http.StatusNotFound)
+	}
+}
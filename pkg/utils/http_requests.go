@@ -8,9 +8,24 @@ import (
 
 var ErrUnsuccessfulRequest = errors.New("unsuccessful request")
 
+// UnsuccessfulRequestError is returned for responses with a non 2xx status code,
+// it matches ErrUnsuccessfulRequest when used with errors.Is.
+type UnsuccessfulRequestError struct {
+	StatusCode int
+	Status     string
+}
+
+func (err UnsuccessfulRequestError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrUnsuccessfulRequest, err.Status)
+}
+
+func (err UnsuccessfulRequestError) Unwrap() error {
+	return ErrUnsuccessfulRequest
+}
+
 func CheckResponseStatus(res *http.Response) error {
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return fmt.Errorf("%w: %v", ErrUnsuccessfulRequest, res.Status)
+		return UnsuccessfulRequestError{StatusCode: res.StatusCode, Status: res.Status}
 	}
 	return nil
 }